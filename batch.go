@@ -0,0 +1,106 @@
+package tail
+
+import "time"
+
+// DefaultBatchLines is used when Batch.MaxLines is zero.
+var DefaultBatchLines = 1000
+
+// Batch sets how TailFileBatches batches lines.
+type Batch struct {
+	MaxLines int // Lines per batch (0: DefaultBatchLines)
+	MaxBytes int // Pass batches once their text reaches MaxBytes (0: no limit)
+
+	// MaxDelay is the longest the first line of a batch waits for more
+	// (0: batches are passed on reaching the end of the file)
+	MaxDelay time.Duration
+}
+
+// TailFileBatches is like TailFile, but passes lines to handler in batches
+// instead of sending them to the Lines channel, one at a time, which
+// saves handing every line over to another goroutine. Batches are passed
+// once full, and otherwise as set by batch.MaxDelay; handler may keep them.
+// An error returned by handler stops the tail, and is returned by Wait.
+// The Lines channel is closed when the tail stops.
+func TailFileBatches(filename string, config Config, batch Batch, handler func([]*Line) error) (*Tail, error) {
+	if batch.MaxLines <= 0 {
+		batch.MaxLines = DefaultBatchLines
+	}
+	return tailFile(filename, config, &batcher{Batch: batch, handler: handler})
+}
+
+// batcher holds the batch being filled for a handler.
+type batcher struct {
+	Batch
+	handler func([]*Line) error
+	lines   []*Line
+	bytes   int
+	since   time.Time // when the first line was added
+	err     error     // returned by handler; lines are dropped after it
+}
+
+// add adds l to the batch, and reports whether the batch is due.
+func (b *batcher) add(l *Line) bool {
+	if b.err != nil {
+		return false
+	}
+	if len(b.lines) == 0 {
+		b.since = time.Now()
+	}
+	b.lines = append(b.lines, l)
+	b.bytes += len(l.Text)
+	return len(b.lines) >= b.MaxLines ||
+		(b.MaxBytes > 0 && b.bytes >= b.MaxBytes) ||
+		(b.MaxDelay > 0 && time.Since(b.since) >= b.MaxDelay)
+}
+
+// flush passes the batch to the handler, if not empty.
+func (b *batcher) flush() error {
+	if len(b.lines) == 0 || b.err != nil {
+		return nil
+	}
+	lines := b.lines
+	b.lines = nil
+	b.bytes = 0
+	b.err = b.handler(lines)
+	return b.err
+}
+
+// timeout returns a channel receiving when the batch is due to be passed,
+// or nil if there is none.
+func (b *batcher) timeout() <-chan time.Time {
+	if b == nil || len(b.lines) == 0 || b.MaxDelay <= 0 {
+		return nil
+	}
+	return time.After(b.MaxDelay - time.Since(b.since))
+}
+
+// send sends l to the Lines channel, or adds it to the batch of the
+// handler.
+func (tail *Tail) send(l *Line) {
+	if tail.batcher == nil {
+		tail.enqueue(l)
+		return
+	}
+	if tail.batcher.add(l) {
+		tail.flushBatch()
+	}
+}
+
+// flushBatch passes the pending batch to the handler, and stops the tail
+// if it fails.
+func (tail *Tail) flushBatch() {
+	if tail.batcher == nil {
+		return
+	}
+	if err := tail.batcher.flush(); err != nil {
+		tail.Kill(err)
+	}
+}
+
+// idleBatch passes the pending batch to the handler once the end of the
+// file is reached, unless it may wait for Batch.MaxDelay.
+func (tail *Tail) idleBatch(final bool) {
+	if tail.batcher != nil && (final || tail.batcher.MaxDelay <= 0) {
+		tail.flushBatch()
+	}
+}
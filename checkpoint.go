@@ -0,0 +1,215 @@
+package tail
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pavamana1123/tail/util"
+)
+
+// DefaultPosFileInterval is used when Config.PosFileInterval is zero.
+var DefaultPosFileInterval = 5 * time.Second
+
+// position is a read position as persisted to Config.PosFile.
+type position struct {
+	Offset int64
+	ID     FileID
+	Frame  frame // of a compressed file, holding Offset; zero at its start
+}
+
+// String formats pos as "offset dev ino", the format of Config.PosFile,
+// followed by where the frame starts in the file and in its content for
+// frames of compressed files past the first.
+func (pos position) String() string {
+	if pos.Frame != (frame{}) {
+		return fmt.Sprintf("%d %d %d %d %d\n", pos.Offset, pos.ID.Dev, pos.ID.Ino,
+			pos.Frame.Compressed, pos.Frame.Decompressed)
+	}
+	return fmt.Sprintf("%d %d %d\n", pos.Offset, pos.ID.Dev, pos.ID.Ino)
+}
+
+// parsePosition parses a position written by position.String. A bare
+// offset, as written by earlier versions, is accepted as well.
+func parsePosition(s string) (pos position, err error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1, 3, 5:
+	default:
+		return pos, fmt.Errorf("malformed position %q", s)
+	}
+	if pos.Offset, err = strconv.ParseInt(fields[0], 10, 64); err != nil {
+		return pos, err
+	}
+	if len(fields) >= 3 {
+		if pos.ID.Dev, err = strconv.ParseUint(fields[1], 10, 64); err != nil {
+			return pos, err
+		}
+		if pos.ID.Ino, err = strconv.ParseUint(fields[2], 10, 64); err != nil {
+			return pos, err
+		}
+	}
+	if len(fields) == 5 {
+		if pos.Frame.Compressed, err = strconv.ParseInt(fields[3], 10, 64); err != nil {
+			return pos, err
+		}
+		if pos.Frame.Decompressed, err = strconv.ParseInt(fields[4], 10, 64); err != nil {
+			return pos, err
+		}
+	}
+	return pos, nil
+}
+
+// readPosFile returns the position saved in filename, or nil if no
+// position has been saved yet.
+func readPosFile(filename string) (*position, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return nil, nil
+	}
+	pos, err := parsePosition(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid position file %s: %s", filename, err)
+	}
+	return &pos, nil
+}
+
+// validFor reports whether pos can be resumed in the file described by fi.
+func (pos position) validFor(fi os.FileInfo) bool {
+	return pos.sameFile(fi) && pos.Offset <= fi.Size()
+}
+
+// sameFile reports whether pos may have been saved for the file described
+// by fi, as far as file identities are known.
+func (pos position) sameFile(fi os.FileInfo) bool {
+	id := fileIDOf(fi)
+	return !pos.ID.known() || !id.known() || pos.ID == id
+}
+
+// ErrNotPending is returned by Tail.Commit for lines that were not sent
+// by the tail or have already been committed.
+var ErrNotPending = errors.New("tail: line is not pending commit")
+
+// checkpoint holds the latest read position and writes it to the
+// position file when flushed.
+type checkpoint struct {
+	filename string
+	sync     func() error // if set, makes what pos passes durable before it is saved
+
+	mu    sync.Mutex
+	pos   position
+	dirty bool
+
+	// Lines sent but not yet committed, oldest first (ExplicitCommit).
+	pending []*pendingLine
+	byNum   map[uint64]*pendingLine // by Line.Num, which survives spilling
+}
+
+type pendingLine struct {
+	pos       position
+	committed bool
+}
+
+func (c *checkpoint) set(pos position) {
+	c.mu.Lock()
+	if pos != c.pos {
+		c.pos = pos
+		c.dirty = true
+	}
+	c.mu.Unlock()
+}
+
+// offset returns the offset of the position.
+func (c *checkpoint) offset() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.pos.Offset
+}
+
+// track registers line as sent; pos is the position just past it.
+func (c *checkpoint) track(line *Line, pos position) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.byNum == nil {
+		c.byNum = make(map[uint64]*pendingLine)
+	}
+	p := &pendingLine{pos: pos}
+	c.pending = append(c.pending, p)
+	c.byNum[line.Num] = p
+}
+
+// commit marks line as processed and advances the position to the end of
+// the longest run of committed lines at the head of the pending queue.
+func (c *checkpoint) commit(line *Line) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	p, ok := c.byNum[line.Num]
+	if !ok {
+		return ErrNotPending
+	}
+	delete(c.byNum, line.Num)
+	p.committed = true
+	c.advance()
+	return nil
+}
+
+// skip records pos as reached by input that was never sent, such as lines
+// dropped by rate limiting, once every line sent before it is committed.
+func (c *checkpoint) skip(pos position) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.pending = append(c.pending, &pendingLine{pos: pos, committed: true})
+	c.advance()
+}
+
+// advance moves the position past committed lines at the head of the
+// pending queue.
+func (c *checkpoint) advance() {
+	n := 0
+	for n < len(c.pending) && c.pending[n].committed {
+		n++
+	}
+	if n > 0 {
+		c.pos = c.pending[n-1].pos
+		c.dirty = true
+		for i := 0; i < n; i++ {
+			c.pending[i] = nil
+		}
+		c.pending = c.pending[n:]
+	}
+}
+
+// flush atomically replaces the position file if the position changed
+// since the last flush.
+func (c *checkpoint) flush() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.dirty {
+		return nil
+	}
+	if c.sync != nil {
+		if err := c.sync(); err != nil {
+			return err
+		}
+	}
+	if err := util.WriteFileAtomic(c.filename, []byte(c.pos.String()), 0644); err != nil {
+		return err
+	}
+	c.dirty = false
+	return nil
+}
@@ -6,42 +6,166 @@ package main
 import (
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
-	"github.com/hpcloud/tail"
+	"github.com/pavamana1123/tail"
 )
 
-func args2config() (tail.Config, int64) {
+// terminator ends the lines printed.
+var terminator = "\n"
+
+// metricsAddr is where to serve metrics, if set.
+var metricsAddr string
+
+// exported serves the metrics of the files tailed, nil unless -metrics is
+// set.
+var exported *exporter
+
+func args2config() (tail.Config, error) {
 	config := tail.Config{Follow: true}
-	n := int64(0)
+	lines, bytes := "", ""
+	since, until, layout, pattern := "", "", "", ""
 	maxlinesize := int(0)
-	flag.Int64Var(&n, "n", 0, "tail from the last Nth location")
+	nul := false
+	flag.StringVar(&lines, "n", "", "output the last `NUM` lines, or use +NUM to output starting with line NUM")
+	flag.StringVar(&bytes, "c", "", "output the last `NUM` bytes, or use +NUM to output starting with byte NUM")
+	flag.StringVar(&since, "since", "", "output starting with the first line logged at or after `TIME` (or DURATION ago)")
+	flag.StringVar(&until, "until", "", "stop before the first line logged after `TIME` (or DURATION ago)")
+	flag.StringVar(&layout, "layout", time.RFC3339, "`layout` of line timestamps, as taken by Go's time.Parse")
+	flag.StringVar(&pattern, "pattern", "", "`regexp` extracting the timestamp from lines (first submatch), instead of the first fields")
 	flag.IntVar(&maxlinesize, "max", 0, "max line size")
 	flag.BoolVar(&config.Follow, "f", false, "wait for additional data to be appended to the file")
 	flag.BoolVar(&config.ReOpen, "F", false, "follow, and track file rename/rotation")
 	flag.BoolVar(&config.Poll, "p", false, "use polling, instead of inotify")
+	flag.BoolVar(&nul, "z", false, "line delimiter is NUL, not newline")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve metrics in the Prometheus text format at http://`ADDR`/metrics")
 	flag.Parse()
 	if config.ReOpen {
 		config.Follow = true
 	}
+	if nul {
+		config.Delimiter = "\x00"
+		terminator = "\x00"
+	}
 	config.MaxLineSize = maxlinesize
-	return config, n
+
+	if bytes != "" {
+		n, fromStart, err := parseCount(bytes)
+		if err != nil {
+			return config, fmt.Errorf("invalid number of bytes: %s", err)
+		}
+		if fromStart {
+			if n > 0 {
+				n--
+			}
+			config.Location = &tail.SeekInfo{Offset: n, Whence: os.SEEK_SET}
+		} else {
+			config.Location = &tail.SeekInfo{Offset: -n, Whence: os.SEEK_END}
+		}
+	}
+	if lines != "" {
+		n, fromStart, err := parseCount(lines)
+		if err != nil {
+			return config, fmt.Errorf("invalid number of lines: %s", err)
+		}
+		config.LineLocation = &tail.LineLocation{Lines: n, FromStart: fromStart}
+	}
+	if since != "" || until != "" {
+		r := &tail.TimeRange{Layout: layout}
+		var err error
+		if r.Since, err = parseTime(since); err != nil {
+			return config, fmt.Errorf("invalid -since: %s", err)
+		}
+		if r.Until, err = parseTime(until); err != nil {
+			return config, fmt.Errorf("invalid -until: %s", err)
+		}
+		if pattern != "" {
+			if r.Pattern, err = regexp.Compile(pattern); err != nil {
+				return config, fmt.Errorf("invalid -pattern: %s", err)
+			}
+		}
+		config.TimeRange = r
+	}
+	return config, nil
+}
+
+// timeLayouts are the layouts accepted by -since and -until, in local time
+// unless told otherwise.
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseTime parses the arguments of -since and -until: a time, or a
+// duration before now.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%q is neither a time like %q nor a duration", s, timeLayouts[1])
+}
+
+// parseCount parses the arguments of -n and -c: NUM or -NUM count from
+// the end, +NUM from the start.
+func parseCount(s string) (n int64, fromStart bool, err error) {
+	switch {
+	case strings.HasPrefix(s, "+"):
+		fromStart = true
+		s = s[1:]
+	case strings.HasPrefix(s, "-"):
+		s = s[1:]
+	}
+	n, err = strconv.ParseInt(s, 10, 64)
+	if err == nil && n < 0 {
+		err = fmt.Errorf("%q is negative", s)
+	}
+	return n, fromStart, err
 }
 
 func main() {
-	config, n := args2config()
+	config, err := args2config()
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	if flag.NFlag() < 1 {
 		fmt.Println("need one or more files as arguments")
 		os.Exit(1)
 	}
 
-	if n != 0 {
-		config.Location = &tail.SeekInfo{-n, os.SEEK_END}
+	if metricsAddr != "" {
+		exported = &exporter{}
+		http.Handle("/metrics", exported)
+		go func() {
+			fmt.Println(http.ListenAndServe(metricsAddr, nil))
+			os.Exit(1)
+		}()
 	}
 
 	done := make(chan bool)
 	for _, filename := range flag.Args() {
-		go tailFile(filename, config, done)
+		if strings.ContainsAny(filename, "*?[") {
+			go tailGlob(filename, config, done)
+		} else {
+			go tailFile(filename, config, done)
+		}
 	}
 
 	for _, _ = range flag.Args() {
@@ -56,8 +180,26 @@ func tailFile(filename string, config tail.Config, done chan bool) {
 		fmt.Println(err)
 		return
 	}
+	exported.add(func() []tail.Stats { return []tail.Stats{t.Stats()} })
+	for line := range t.Lines {
+		fmt.Print(string(line.Text), terminator)
+	}
+	err = t.Wait()
+	if err != nil {
+		fmt.Println(err)
+	}
+}
+
+func tailGlob(pattern string, config tail.Config, done chan bool) {
+	defer func() { done <- true }()
+	t, err := tail.TailGlob(pattern, config)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	exported.add(t.Stats)
 	for line := range t.Lines {
-		fmt.Println(line.Text)
+		fmt.Printf("%s: %s%s", filepath.Base(line.Filename), line.Text, terminator)
 	}
 	err = t.Wait()
 	if err != nil {
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pavamana1123/tail"
+)
+
+func TestParseCount(t *testing.T) {
+	for _, test := range []struct {
+		s         string
+		n         int64
+		fromStart bool
+	}{
+		{"10", 10, false},
+		{"-10", 10, false},
+		{"+10", 10, true},
+		{"0", 0, false},
+	} {
+		n, fromStart, err := parseCount(test.s)
+		if err != nil || n != test.n || fromStart != test.fromStart {
+			t.Errorf("parseCount(%q) = %d, %v, %v; want %d, %v", test.s, n, fromStart, err, test.n, test.fromStart)
+		}
+	}
+	for _, s := range []string{"", "x", "+-1", "--1"} {
+		if _, _, err := parseCount(s); err == nil {
+			t.Errorf("parseCount(%q) did not fail", s)
+		}
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	if tm, err := parseTime(""); err != nil || !tm.IsZero() {
+		t.Errorf("parseTime(\"\") = %v, %v; want the zero time", tm, err)
+	}
+	want := time.Date(2006, 1, 2, 15, 4, 0, 0, time.Local)
+	if tm, err := parseTime("2006-01-02 15:04"); err != nil || !tm.Equal(want) {
+		t.Errorf("parseTime = %v, %v; want %v", tm, err, want)
+	}
+	if tm, err := parseTime("1h"); err != nil || time.Since(tm) < time.Hour {
+		t.Errorf("parseTime(\"1h\") = %v, %v; want an hour ago", tm, err)
+	}
+	if _, err := parseTime("yesterday"); err == nil {
+		t.Error("parseTime(\"yesterday\") did not fail")
+	}
+}
+
+func TestExporter(t *testing.T) {
+	e := &exporter{}
+	e.add(func() []tail.Stats {
+		return []tail.Stats{{Filename: `a"b.log`, LinesRead: 3, Offset: 12}}
+	})
+	w := httptest.NewRecorder()
+	e.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	for _, want := range []string{
+		"# TYPE gotail_read_lines_total counter\n",
+		`gotail_read_lines_total{file="a\"b.log"} 3` + "\n",
+		`gotail_offset_bytes{file="a\"b.log"} 12` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics do not contain %q:\n%s", want, body)
+		}
+	}
+
+	// a nil exporter, without -metrics, ignores sources
+	var none *exporter
+	none.add(func() []tail.Stats { return nil })
+}
+
+func TestTailFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "test.log")
+	if err := ioutil.WriteFile(name, []byte("hello\nworld\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan bool, 1)
+	tailFile(name, tail.Config{}, done)
+	os.Stdout = stdout
+	w.Close()
+	<-done
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello\nworld\n" {
+		t.Errorf("printed %q, want %q", out, "hello\nworld\n")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pavamana1123/tail"
+)
+
+// exporter serves the Stats of the files tailed in the Prometheus text
+// format.
+type exporter struct {
+	mu      sync.Mutex
+	sources []func() []tail.Stats
+}
+
+// add adds the files of source to the metrics served; e may be nil.
+func (e *exporter) add(source func() []tail.Stats) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	e.sources = append(e.sources, source)
+	e.mu.Unlock()
+}
+
+// metrics are the metrics served, from the Stats of each file.
+var metrics = []struct {
+	name, typ, help string
+	value           func(s tail.Stats) float64
+}{
+	{"gotail_read_bytes_total", "counter", "Bytes of the lines read.",
+		func(s tail.Stats) float64 { return float64(s.BytesRead) }},
+	{"gotail_read_lines_total", "counter", "Lines read.",
+		func(s tail.Stats) float64 { return float64(s.LinesRead) }},
+	{"gotail_offset_bytes", "gauge", "Position read up to in the file.",
+		func(s tail.Stats) float64 { return float64(s.Offset) }},
+	{"gotail_size_bytes", "gauge", "Size of the file.",
+		func(s tail.Stats) float64 { return float64(s.Size) }},
+	{"gotail_lag_bytes", "gauge", "Bytes of the file left to read.",
+		func(s tail.Stats) float64 { return float64(s.Lag) }},
+	{"gotail_reopens_total", "counter", "Reopens of the file after it was moved, deleted, truncated or retargeted.",
+		func(s tail.Stats) float64 { return float64(s.Reopens) }},
+	{"gotail_truncations_total", "counter", "Truncations of the file.",
+		func(s tail.Stats) float64 { return float64(s.Truncations) }},
+	{"gotail_symlink_changes_total", "counter", "Changes of the target of the file, when a symlink.",
+		func(s tail.Stats) float64 { return float64(s.SymlinkChanges) }},
+	{"gotail_watcher_errors_total", "counter", "Errors watching the file.",
+		func(s tail.Stats) float64 { return float64(s.WatcherErrors) }},
+	{"gotail_idle_seconds", "gauge", "Time since the last line was read.",
+		func(s tail.Stats) float64 { return s.Idle.Seconds() }},
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (e *exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	var stats []tail.Stats
+	for _, source := range e.sources {
+		stats = append(stats, source()...)
+	}
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+		for _, s := range stats {
+			fmt.Fprintf(w, "%s{file=\"%s\"} %s\n", m.name, labelEscaper.Replace(s.Filename),
+				strconv.FormatFloat(m.value(s), 'g', -1, 64))
+		}
+	}
+}
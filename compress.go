@@ -0,0 +1,349 @@
+package tail
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Decompressor returns a reader of the decompressed content of r.
+type Decompressor func(r io.Reader) (io.Reader, error)
+
+// compression is a compressed file format, recognized by its magic bytes.
+type compression struct {
+	name       string
+	magic      string // '?' matches any byte
+	decompress Decompressor
+	frames     func(f *os.File) (frames, error) // if nil, f is one frame read with decompress
+}
+
+var (
+	compressionsMu sync.RWMutex
+	compressions   = []compression{
+		{"gzip", "\x1f\x8b", func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }, newGzipFrames},
+		{"bzip2", "BZh?\x31\x41\x59\x26\x53\x59", func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil }, nil},
+	}
+)
+
+// RegisterDecompressor registers how to decompress the files starting with
+// magic, where '?' matches any byte. A format registered under an existing
+// name replaces it. gzip, bzip2, zstd (with Go 1.22 or later) and xz are
+// supported out of the box. Files of registered formats are decompressed
+// from their start when reading resumes from a saved position.
+func RegisterDecompressor(name, magic string, d Decompressor) {
+	compressionsMu.Lock()
+	defer compressionsMu.Unlock()
+
+	for i := range compressions {
+		if compressions[i].name == name {
+			compressions[i] = compression{name, magic, d, nil}
+			return
+		}
+	}
+	compressions = append(compressions, compression{name, magic, d, nil})
+}
+
+// detectCompression returns the format of the file, or nil if it is not
+// compressed.
+func detectCompression(f *os.File) (*compression, error) {
+	compressionsMu.RLock()
+	defer compressionsMu.RUnlock()
+
+	size := 0
+	for _, c := range compressions {
+		if len(c.magic) > size {
+			size = len(c.magic)
+		}
+	}
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	buf = buf[:n]
+
+	for _, c := range compressions {
+		if matchMagic(c.magic, buf) {
+			c := c
+			return &c, nil
+		}
+	}
+	return nil, nil
+}
+
+func matchMagic(magic string, b []byte) bool {
+	if len(magic) > len(b) {
+		return false
+	}
+	for i := 0; i < len(magic); i++ {
+		if magic[i] != '?' && magic[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// frames reads the frames a compressed file is made of: gzip members, zstd
+// frames or xz blocks, each decompressed independently of the ones before
+// it. Reading resumes from the frame holding a position, without
+// decompressing the file from its start.
+type frames interface {
+	// open returns a reader of the content of the frame starting at
+	// offset in the file, and a function returning where the next frame
+	// starts, or -1 if there is none, once the reader returned io.EOF.
+	open(offset int64) (io.Reader, func() (int64, error), error)
+	close()
+}
+
+// frame is where a frame starts in a compressed file and in its content.
+type frame struct {
+	Compressed, Decompressed int64
+}
+
+// wholeFile reads a file as a single frame.
+type wholeFile struct {
+	file       *os.File
+	decompress Decompressor
+	r          io.Reader
+}
+
+func (w *wholeFile) open(offset int64) (io.Reader, func() (int64, error), error) {
+	if offset != 0 {
+		return nil, nil, fmt.Errorf("no frame at offset %d", offset)
+	}
+	w.close()
+	r, err := w.decompress(io.NewSectionReader(w.file, 0, maxOffset))
+	if err != nil {
+		return nil, nil, err
+	}
+	w.r = r
+	return r, func() (int64, error) { return -1, nil }, nil
+}
+
+func (w *wholeFile) close() {
+	if c, ok := w.r.(io.Closer); ok {
+		c.Close()
+	}
+}
+
+// maxOffset is the size of the sections read up to the end of a file.
+const maxOffset = 1<<63 - 1
+
+// gzipFrames reads the members of a gzip file.
+type gzipFrames struct {
+	file *os.File
+	z    *gzip.Reader
+}
+
+func newGzipFrames(f *os.File) (frames, error) {
+	return &gzipFrames{file: f}, nil
+}
+
+func (g *gzipFrames) open(offset int64) (io.Reader, func() (int64, error), error) {
+	section := io.NewSectionReader(g.file, offset, maxOffset-offset)
+	// buffered by the frames, so that the end of the member is known
+	r := bufio.NewReader(section)
+	var err error
+	if g.z == nil {
+		g.z, err = gzip.NewReader(r)
+	} else {
+		err = g.z.Reset(r)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	g.z.Multistream(false)
+	next := func() (int64, error) {
+		read, err := section.Seek(0, os.SEEK_CUR)
+		if err != nil {
+			return -1, err
+		}
+		end := offset + read - int64(r.Buffered())
+		// anything but another member, such as padding, ends the file
+		magic := make([]byte, 2)
+		if n, _ := g.file.ReadAt(magic, end); n < len(magic) || string(magic) != "\x1f\x8b" {
+			return -1, nil
+		}
+		return end, nil
+	}
+	return g.z, next, nil
+}
+
+func (g *gzipFrames) close() {
+	if g.z != nil {
+		g.z.Close()
+	}
+}
+
+// decompressedFile reads the decompressed content of a file. Offsets are
+// in the decompressed content; seeking backwards decompresses the file
+// again from the frame holding the offset.
+type decompressedFile struct {
+	file        *os.File
+	compression *compression
+	frames      frames
+	r           io.Reader             // content of the current frame
+	next        func() (int64, error) // where the frame after it starts
+	started     []frame               // frames read so far, by offset
+	pos         int64                 // accessed atomically, for Tail.Tell
+}
+
+func newDecompressedFile(f *os.File, c *compression) (*decompressedFile, error) {
+	if c.decompress == nil && c.frames == nil {
+		return nil, fmt.Errorf("no decompressor registered for %s files", c.name)
+	}
+	d := &decompressedFile{file: f, compression: c}
+	if c.frames == nil {
+		d.frames = &wholeFile{file: f, decompress: c.decompress}
+	} else {
+		var err error
+		if d.frames, err = c.frames(f); err != nil {
+			return nil, err
+		}
+	}
+	if err := d.open(frame{}); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// head returns the first n bytes of the content, or all of it if shorter,
+// decompressed on their own as reading may have resumed past them.
+func (d *decompressedFile) head(n int) ([]byte, error) {
+	start, err := newDecompressedFile(d.file, d.compression)
+	if err != nil {
+		return nil, err
+	}
+	defer start.Close()
+	b := make([]byte, n)
+	n, err = io.ReadFull(start, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return b[:n], err
+}
+
+// open starts reading the frame fr.
+func (d *decompressedFile) open(fr frame) error {
+	r, next, err := d.frames.open(fr.Compressed)
+	if err != nil {
+		return err
+	}
+	d.r, d.next = r, next
+	atomic.StoreInt64(&d.pos, fr.Decompressed)
+
+	i := sort.Search(len(d.started), func(i int) bool {
+		return d.started[i].Compressed >= fr.Compressed
+	})
+	if i == len(d.started) || d.started[i] != fr {
+		d.started = append(d.started, frame{})
+		copy(d.started[i+1:], d.started[i:])
+		d.started[i] = fr
+	}
+	return nil
+}
+
+// frameAt returns the frame holding offset, among the frames read so far.
+func (d *decompressedFile) frameAt(offset int64) frame {
+	i := sort.Search(len(d.started), func(i int) bool {
+		return d.started[i].Decompressed > offset
+	})
+	if i == 0 {
+		return frame{}
+	}
+	return d.started[i-1]
+}
+
+func (d *decompressedFile) Read(p []byte) (int, error) {
+	for {
+		n, err := d.r.Read(p)
+		pos := atomic.AddInt64(&d.pos, int64(n))
+		if err != io.EOF {
+			return n, err
+		}
+		if n > 0 {
+			// the next read moves on to the next frame
+			return n, nil
+		}
+		offset, err := d.next()
+		if err != nil {
+			return 0, err
+		}
+		if offset < 0 {
+			return 0, io.EOF
+		}
+		if err := d.open(frame{offset, pos}); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Seek sets the offset in the decompressed content. Seeking past its end
+// stops at the end.
+func (d *decompressedFile) Seek(offset int64, whence int) (int64, error) {
+	pos := atomic.LoadInt64(&d.pos)
+	switch whence {
+	case os.SEEK_SET:
+	case os.SEEK_CUR:
+		offset += pos
+	case os.SEEK_END:
+		if _, err := io.Copy(ioutil.Discard, d); err != nil {
+			return pos, err
+		}
+		pos = atomic.LoadInt64(&d.pos)
+		offset += pos
+	default:
+		return pos, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return pos, fmt.Errorf("negative offset %d", offset)
+	}
+
+	if offset < pos {
+		fr := d.frameAt(offset)
+		if err := d.open(fr); err != nil {
+			return pos, err
+		}
+		pos = fr.Decompressed
+	}
+	if offset > pos {
+		_, err := io.CopyN(ioutil.Discard, d, offset-pos)
+		if err != nil && err != io.EOF {
+			return atomic.LoadInt64(&d.pos), err
+		}
+	}
+	return atomic.LoadInt64(&d.pos), nil
+}
+
+// Close releases the decompressor; the file is closed by its owner.
+func (d *decompressedFile) Close() error {
+	d.frames.close()
+	return nil
+}
+
+// decompress sets up reading File decompressed, if it is compressed.
+func (tail *Tail) decompress() error {
+	c, err := detectCompression(tail.File)
+	if err != nil || c == nil {
+		return err
+	}
+	tail.decompressed, err = newDecompressedFile(tail.File, c)
+	return err
+}
+
+// input returns what lines are read from: File, or its decompressed
+// content.
+func (tail *Tail) input() io.ReadSeeker {
+	if tail.decompressed != nil {
+		return tail.decompressed
+	}
+	return tail.File
+}
@@ -0,0 +1,289 @@
+//go:build go1.12
+// +build go1.12
+
+package tail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ulikunitz/xz"
+	"github.com/ulikunitz/xz/lzma"
+)
+
+const xzMagic = "\xfd7zXZ\x00"
+
+// xz files are read with Go 1.12 or later, which github.com/ulikunitz/xz
+// needs.
+func init() {
+	compressions = append(compressions, compression{"xz", xzMagic, decompressXz, newXzFrames})
+}
+
+func decompressXz(r io.Reader) (io.Reader, error) {
+	return xz.NewReader(r)
+}
+
+// xzChecks are the checks of the blocks of xz streams that are verified
+// when blocks are read on their own; streams with other checks are read
+// whole.
+var xzChecks = map[byte]func() hash.Hash{
+	0x00: nil,
+	0x01: func() hash.Hash { return crc32.NewIEEE() },
+	0x04: func() hash.Hash { return crc64.New(crc64.MakeTable(crc64.ECMA)) },
+	0x0a: sha256.New,
+}
+
+// xzFrame is a block of an xz file, or a whole stream of which some blocks
+// cannot be read on their own.
+type xzFrame struct {
+	offset, size int64 // in the file, padding included
+	stream       bool
+
+	// of blocks
+	unpadded, uncompressed int64
+	check                  byte  // check type of the stream
+	data                   int64 // offset of the compressed data
+	dictCap                int64
+}
+
+// xzFrames reads the blocks of an xz file, found from the indexes at the
+// end of its streams. Blocks compressed with LZMA2 alone, as by xz, are
+// read on their own.
+type xzFrames struct {
+	file   *os.File
+	frames []xzFrame
+}
+
+var errXzIndex = errors.New("xz: malformed stream index")
+
+func newXzFrames(f *os.File) (frames, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	x := &xzFrames{file: f}
+	if err := x.scan(fi.Size()); err != nil {
+		// read as a single frame, such as while still being written
+		return &wholeFile{file: f, decompress: decompressXz}, nil
+	}
+	return x, nil
+}
+
+// scan finds the frames of the streams before end, from the last.
+func (x *xzFrames) scan(end int64) error {
+	var b [12]byte
+	for end > 0 {
+		// stream padding
+		for {
+			if end < 24 {
+				// too short for a header and a footer
+				return errXzIndex
+			}
+			if _, err := x.file.ReadAt(b[:4], end-4); err != nil {
+				return err
+			}
+			if binary.LittleEndian.Uint32(b[:4]) != 0 {
+				break
+			}
+			end -= 4
+		}
+
+		// footer, index
+		if _, err := x.file.ReadAt(b[:], end-12); err != nil {
+			return err
+		}
+		if string(b[10:]) != "YZ" {
+			return errXzIndex
+		}
+		flags := string(b[8:10])
+		check := b[9] & 0x0f
+		indexStart := end - 12 - (int64(binary.LittleEndian.Uint32(b[4:8]))+1)*4
+		if indexStart < 12 {
+			return errXzIndex
+		}
+		index := make([]byte, end-12-indexStart)
+		if _, err := x.file.ReadAt(index, indexStart); err != nil {
+			return err
+		}
+		if index[0] != 0 || crc32.ChecksumIEEE(index[:len(index)-4]) != binary.LittleEndian.Uint32(index[len(index)-4:]) {
+			return errXzIndex
+		}
+		p := index[1 : len(index)-4]
+		count, n := binary.Uvarint(p)
+		if n <= 0 || count > uint64(len(p)) {
+			return errXzIndex
+		}
+		p = p[n:]
+		blocks := make([]xzFrame, count)
+		var size int64
+		for i := range blocks {
+			unpadded, n := binary.Uvarint(p)
+			if n <= 0 {
+				return errXzIndex
+			}
+			p = p[n:]
+			uncompressed, n := binary.Uvarint(p)
+			if n <= 0 {
+				return errXzIndex
+			}
+			p = p[n:]
+			blocks[i] = xzFrame{offset: size, size: (int64(unpadded) + 3) &^ 3,
+				unpadded: int64(unpadded), uncompressed: int64(uncompressed), check: check}
+			size += blocks[i].size
+		}
+
+		// header
+		start := indexStart - size - 12
+		if start < 0 {
+			return errXzIndex
+		}
+		if _, err := x.file.ReadAt(b[:], start); err != nil {
+			return err
+		}
+		if string(b[:6]) != xzMagic || string(b[6:8]) != flags {
+			return errXzIndex
+		}
+
+		_, blockwise := xzChecks[check]
+		for i := range blocks {
+			blocks[i].offset += start + 12
+			if blockwise && !x.readBlockHeader(&blocks[i]) {
+				blockwise = false
+			}
+		}
+		if !blockwise {
+			blocks = []xzFrame{{offset: start, size: end - start, stream: true}}
+		}
+		x.frames = append(blocks, x.frames...)
+		end = start
+	}
+	return nil
+}
+
+// readBlockHeader reads the header of block, and reports whether it is
+// compressed with LZMA2 alone.
+func (x *xzFrames) readBlockHeader(block *xzFrame) bool {
+	var b [1024]byte
+	if _, err := x.file.ReadAt(b[:1], block.offset); err != nil || b[0] == 0 {
+		return false
+	}
+	h := b[:(int(b[0])+1)*4]
+	if _, err := x.file.ReadAt(h, block.offset); err != nil {
+		return false
+	}
+	if crc32.ChecksumIEEE(h[:len(h)-4]) != binary.LittleEndian.Uint32(h[len(h)-4:]) {
+		return false
+	}
+	flags := h[1]
+	if flags&0x3f != 0 {
+		// more than one filter, or reserved bits
+		return false
+	}
+	p := h[2 : len(h)-4]
+	var fields [4]uint64 // sizes, if present, filter ID and size of its properties
+	for i := range fields {
+		if i < 2 && flags&(0x40<<uint(i)) == 0 {
+			continue
+		}
+		var n int
+		if fields[i], n = binary.Uvarint(p); n <= 0 {
+			return false
+		}
+		p = p[n:]
+	}
+	if fields[2] != 0x21 || fields[3] != 1 || len(p) == 0 {
+		return false
+	}
+	dictCap, err := lzma.DecodeDictCap(p[0])
+	if err != nil {
+		return false
+	}
+	// the dictionary need not be larger than the content
+	if block.uncompressed < dictCap {
+		dictCap = block.uncompressed
+	}
+	if dictCap < lzma.MinDictCap {
+		dictCap = lzma.MinDictCap
+	}
+	block.data = block.offset + int64(len(h))
+	block.dictCap = dictCap
+	return true
+}
+
+func (x *xzFrames) open(offset int64) (io.Reader, func() (int64, error), error) {
+	i := sort.Search(len(x.frames), func(i int) bool { return x.frames[i].offset >= offset })
+	next := func() (int64, error) {
+		if i+1 < len(x.frames) {
+			return x.frames[i+1].offset, nil
+		}
+		return -1, nil
+	}
+	if i == len(x.frames) && offset == 0 {
+		// no blocks
+		return bytes.NewReader(nil), next, nil
+	}
+	// the start of the file is before the first block
+	if i == len(x.frames) || x.frames[i].offset != offset && offset != 0 {
+		return nil, nil, fmt.Errorf("no xz block at offset %d", offset)
+	}
+
+	f := x.frames[i]
+	if f.stream {
+		r, err := xz.ReaderConfig{SingleStream: true}.NewReader(io.NewSectionReader(x.file, f.offset, f.size))
+		return r, next, err
+	}
+	newHash := xzChecks[f.check]
+	var checkSize int64
+	if newHash != nil {
+		checkSize = int64(newHash().Size())
+	}
+	data := io.NewSectionReader(x.file, f.data, f.offset+f.unpadded-checkSize-f.data)
+	r, err := lzma.Reader2Config{DictCap: int(f.dictCap)}.NewReader2(data)
+	if err != nil || newHash == nil {
+		return r, next, err
+	}
+	return &xzBlockReader{r: r, hash: newHash(), file: x.file, check: f.offset + f.size - checkSize}, next, nil
+}
+
+func (x *xzFrames) close() {}
+
+// xzBlockReader reads the content of a block, verifying its check.
+type xzBlockReader struct {
+	r     io.Reader
+	hash  hash.Hash
+	file  *os.File
+	check int64 // offset of the check
+}
+
+func (b *xzBlockReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.hash.Write(p[:n])
+	if err != io.EOF {
+		return n, err
+	}
+
+	sum := b.hash.Sum(nil)
+	check := make([]byte, len(sum))
+	if _, err := b.file.ReadAt(check, b.check); err != nil {
+		return n, err
+	}
+	if len(check) <= 8 {
+		// CRCs are little-endian
+		for i, j := 0, len(check)-1; i < j; i, j = i+1, j-1 {
+			check[i], check[j] = check[j], check[i]
+		}
+	}
+	if !bytes.Equal(sum, check) {
+		return n, errors.New("xz: block check mismatch")
+	}
+	return n, io.EOF
+}
@@ -0,0 +1,128 @@
+//go:build go1.22
+// +build go1.22
+
+package tail
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const zstdMagic = "\x28\xb5\x2f\xfd"
+
+// zstd files are read with Go 1.22 or later, which
+// github.com/klauspost/compress needs.
+func init() {
+	compressions = append(compressions, compression{"zstd", zstdMagic, func(r io.Reader) (io.Reader, error) {
+		return zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	}, newZstdFrames})
+}
+
+// zstdFrames reads the frames of a zstd file, whose ends are found from
+// the headers of their blocks.
+type zstdFrames struct {
+	file *os.File
+	d    *zstd.Decoder
+}
+
+func newZstdFrames(f *os.File) (frames, error) {
+	d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &zstdFrames{file: f, d: d}, nil
+}
+
+func (z *zstdFrames) open(offset int64) (io.Reader, func() (int64, error), error) {
+	size, err := z.frameSize(offset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := z.d.Reset(io.NewSectionReader(z.file, offset, size)); err != nil {
+		return nil, nil, err
+	}
+	next := func() (int64, error) {
+		return z.skip(offset + size)
+	}
+	return z.d, next, nil
+}
+
+// skip returns where the frame at or after offset starts, past skippable
+// frames, or -1 if there is none.
+func (z *zstdFrames) skip(offset int64) (int64, error) {
+	for {
+		var h [8]byte
+		n, err := z.file.ReadAt(h[:], offset)
+		if n < 4 {
+			return -1, nil
+		}
+		magic := binary.LittleEndian.Uint32(h[:])
+		switch {
+		case string(h[:4]) == zstdMagic:
+			return offset, nil
+		case magic&0xfffffff0 == 0x184d2a50:
+			if n < len(h) {
+				return -1, err
+			}
+			offset += int64(len(h)) + int64(binary.LittleEndian.Uint32(h[4:]))
+		default:
+			// anything else, such as padding, ends the file
+			return -1, nil
+		}
+	}
+}
+
+// frameSize returns the size of the frame at offset.
+func (z *zstdFrames) frameSize(offset int64) (int64, error) {
+	var h [4 + 1 + 1 + 4 + 8]byte
+	n, err := z.file.ReadAt(h[:], offset)
+	if n < 5 {
+		return 0, fmt.Errorf("zstd frame at offset %d: %v", offset, err)
+	}
+	if string(h[:4]) != zstdMagic {
+		return 0, fmt.Errorf("no zstd frame at offset %d", offset)
+	}
+	descriptor := h[4]
+	size := int64(5)
+	singleSegment := descriptor&0x20 != 0
+	if !singleSegment {
+		size++ // window descriptor
+	}
+	size += []int64{0, 1, 2, 4}[descriptor&3] // dictionary ID
+	switch fcs := descriptor >> 6; {
+	case fcs == 0 && singleSegment:
+		size++
+	case fcs > 0:
+		size += 1 << fcs // content size
+	}
+
+	var b [3]byte
+	for last := false; !last; {
+		if _, err := z.file.ReadAt(b[:], offset+size); err != nil {
+			return 0, fmt.Errorf("zstd frame at offset %d: %v", offset, err)
+		}
+		header := uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+		last = header&1 != 0
+		size += 3
+		switch header >> 1 & 3 {
+		case 0, 2: // raw, compressed
+			size += int64(header >> 3)
+		case 1: // RLE
+			size++
+		default:
+			return 0, fmt.Errorf("zstd frame at offset %d: reserved block type", offset)
+		}
+	}
+	if descriptor&0x04 != 0 {
+		size += 4 // checksum
+	}
+	return size, nil
+}
+
+func (z *zstdFrames) close() {
+	z.d.Close()
+}
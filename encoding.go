@@ -0,0 +1,242 @@
+package tail
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// InvalidUTF8Policy selects what happens to lines that are not valid
+// UTF-8 once decoded from Config.Encoding.
+type InvalidUTF8Policy int
+
+const (
+	// KeepInvalidUTF8 sends lines as they are.
+	KeepInvalidUTF8 InvalidUTF8Policy = iota
+	// ReplaceInvalidUTF8 replaces invalid sequences with U+FFFD.
+	ReplaceInvalidUTF8
+	// ReportInvalidUTF8 sends lines as they are, with an InvalidUTF8Error.
+	ReportInvalidUTF8
+)
+
+// InvalidUTF8Error is the Err of lines that are not valid UTF-8, with
+// ReportInvalidUTF8.
+type InvalidUTF8Error struct {
+	Index int // Index of the first invalid byte in Line.Text
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("invalid UTF-8 at byte %d", e.Index)
+}
+
+// encoding is a character encoding lines can be decoded from.
+type encoding struct {
+	name   string
+	unit   int                          // size of code units, to frame lines on
+	order  utf16Order                   // byte order of UTF-16 encodings
+	decode func([]byte) ([]byte, error) // nil for UTF-8
+}
+
+type utf16Order int
+
+const (
+	notUTF16 utf16Order = iota
+	littleEndian
+	bigEndian
+)
+
+var (
+	encodingsMu sync.RWMutex
+	encodings   = map[string]*encoding{
+		"utf-8":    {name: "utf-8", unit: 1},
+		"utf-16":   {name: "utf-16le", unit: 2, order: littleEndian, decode: decodeUTF16LE},
+		"utf-16le": {name: "utf-16le", unit: 2, order: littleEndian, decode: decodeUTF16LE},
+		"utf-16be": {name: "utf-16be", unit: 2, order: bigEndian, decode: decodeUTF16BE},
+		"latin1":   {name: "latin1", unit: 1, decode: decodeLatin1},
+	}
+)
+
+func init() {
+	encodings["iso-8859-1"] = encodings["latin1"]
+}
+
+// RegisterEncoding registers how to decode lines from an encoding that is
+// a superset of ASCII, such as EUC-JP, to UTF-8. decode must be safe for
+// concurrent use. Encodings other than UTF-8, UTF-16, Latin-1 and
+// Shift-JIS need a decoder from another package, e.g. with
+// golang.org/x/text:
+//
+//	tail.RegisterEncoding("euc-jp", func(b []byte) ([]byte, error) {
+//		return japanese.EUCJP.NewDecoder().Bytes(b)
+//	})
+func RegisterEncoding(name string, decode func([]byte) ([]byte, error)) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	name = strings.ToLower(name)
+	encodings[name] = &encoding{name: name, unit: 1, decode: decode}
+}
+
+// lookupEncoding returns the named encoding, or nil for "".
+func lookupEncoding(name string) (*encoding, error) {
+	if name == "" {
+		return nil, nil
+	}
+	encodingsMu.RLock()
+	enc := encodings[strings.ToLower(name)]
+	encodingsMu.RUnlock()
+
+	if enc == nil {
+		return nil, fmt.Errorf("tail: unknown encoding %q", name)
+	}
+	if enc.unit == 1 && enc.decode == nil && enc.name != "utf-8" {
+		return nil, fmt.Errorf("tail: no decoder registered for %s", enc.name)
+	}
+	return enc, nil
+}
+
+// bom returns the encoding announced by the byte order mark starting b,
+// and the length of the mark.
+func bom(b []byte) (*encoding, int) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xef, 0xbb, 0xbf}):
+		return encodings["utf-8"], 3
+	case bytes.HasPrefix(b, []byte{0xff, 0xfe}):
+		return encodings["utf-16le"], 2
+	case bytes.HasPrefix(b, []byte{0xfe, 0xff}):
+		return encodings["utf-16be"], 2
+	}
+	return nil, 0
+}
+
+// encode returns s, which is UTF-8, in the encoding. Encodings other than
+// UTF-16 are taken to be supersets of ASCII.
+func (enc *encoding) encode(s string) []byte {
+	if enc == nil || enc.order == notUTF16 {
+		return []byte(s)
+	}
+	units := utf16.Encode([]rune(s))
+	b := make([]byte, 0, 2*len(units))
+	for _, u := range units {
+		if enc.order == littleEndian {
+			b = append(b, byte(u), byte(u>>8))
+		} else {
+			b = append(b, byte(u>>8), byte(u))
+		}
+	}
+	return b
+}
+
+func decodeUTF16LE(b []byte) ([]byte, error) {
+	return decodeUTF16(b, func(b []byte) uint16 { return uint16(b[0]) | uint16(b[1])<<8 })
+}
+
+func decodeUTF16BE(b []byte) ([]byte, error) {
+	return decodeUTF16(b, func(b []byte) uint16 { return uint16(b[0])<<8 | uint16(b[1]) })
+}
+
+func decodeUTF16(b []byte, unit func([]byte) uint16) ([]byte, error) {
+	units := make([]uint16, 0, len(b)/2+1)
+	for ; len(b) >= 2; b = b[2:] {
+		units = append(units, unit(b))
+	}
+	if len(b) > 0 {
+		// odd trailing byte
+		units = append(units, utf8.RuneError)
+	}
+	return []byte(string(utf16.Decode(units))), nil
+}
+
+func decodeLatin1(b []byte) ([]byte, error) {
+	buf := make([]byte, 0, len(b))
+	for _, c := range b {
+		buf = append(buf, string(rune(c))...)
+	}
+	return buf, nil
+}
+
+// invalidUTF8 returns the index of the first invalid UTF-8 sequence in b,
+// or -1.
+func invalidUTF8(b []byte) int {
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+// replaceInvalidUTF8 returns b with invalid sequences replaced by U+FFFD.
+func replaceInvalidUTF8(b []byte) []byte {
+	buf := make([]byte, 0, len(b))
+	for i := 0; i < len(b); {
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf = append(buf, string(utf8.RuneError)...)
+		} else {
+			buf = append(buf, b[i:i+size]...)
+		}
+		i += size
+	}
+	return buf
+}
+
+// detectEncoding sets the encoding of the file being read, as announced by
+// a byte order mark or otherwise by Config.Encoding, and skips the mark if
+// reading from the start of the file. Called before opening the reader.
+func (tail *Tail) detectEncoding() {
+	tail.encoding, _ = lookupEncoding(tail.Encoding)
+	if tail.encoding == nil || tail.Pipe {
+		return
+	}
+
+	input := tail.input()
+	pos, err := input.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return
+	}
+	head := make([]byte, 3)
+	if tail.decompressed == nil {
+		n, _ := tail.File.ReadAt(head, 0)
+		head = head[:n]
+	} else {
+		head, _ = tail.decompressed.head(len(head))
+	}
+
+	enc, n := bom(head)
+	if enc == nil {
+		return
+	}
+	tail.encoding = enc
+	if pos == 0 {
+		input.Seek(int64(n), os.SEEK_SET)
+	}
+}
+
+// decodeLine converts the text of l from the encoding of the file to
+// UTF-8, and applies Config.InvalidUTF8. Text that fails to decode is
+// left as is.
+func (tail *Tail) decodeLine(l *Line) {
+	if tail.encoding != nil && tail.encoding.decode != nil {
+		if text, err := tail.encoding.decode(l.Text); err == nil {
+			l.Text = text
+		}
+	}
+
+	switch tail.InvalidUTF8 {
+	case ReplaceInvalidUTF8:
+		if !utf8.Valid(l.Text) {
+			l.Text = replaceInvalidUTF8(l.Text)
+		}
+	case ReportInvalidUTF8:
+		if i := invalidUTF8(l.Text); i >= 0 && l.Err == nil {
+			l.Err = &InvalidUTF8Error{Index: i}
+		}
+	}
+}
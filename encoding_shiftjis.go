@@ -0,0 +1,17 @@
+//go:build go1.18
+// +build go1.18
+
+package tail
+
+import "golang.org/x/text/encoding/japanese"
+
+func init() {
+	encodings["shift_jis"] = &encoding{name: "shift_jis", unit: 1, decode: decodeShiftJIS}
+	encodings["sjis"] = encodings["shift_jis"]
+}
+
+// decodeShiftJIS decodes Shift-JIS, of which the second bytes of double
+// byte characters are never ASCII control characters such as newlines.
+func decodeShiftJIS(b []byte) ([]byte, error) {
+	return japanese.ShiftJIS.NewDecoder().Bytes(b)
+}
@@ -0,0 +1,89 @@
+package tail
+
+import (
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/tomb.v1"
+)
+
+// EventType is the type of the lifecycle events of a tail.
+type EventType int
+
+const (
+	// FileOpened: the file was opened, first or after one of the events
+	// below. Offset is 0.
+	FileOpened EventType = iota
+	// FileRotated: the file was moved or deleted, and was read up to
+	// Offset.
+	FileRotated
+	// FileTruncated: the file was truncated from Size bytes while read up
+	// to Offset.
+	FileTruncated
+	// SymlinkRetargeted: Filename, a symlink, was pointed to another file;
+	// the previous one was read up to Offset.
+	SymlinkRetargeted
+	// WaitingForFile: the file does not exist, and is waited for.
+	WaitingForFile
+	// ReachedEOF: the end of the file was reached, at Offset, after lines
+	// were read.
+	ReachedEOF
+	// Stopped: the tail is done, for reason Err if not nil.
+	Stopped
+)
+
+var eventTypeNames = []string{
+	"FileOpened",
+	"FileRotated",
+	"FileTruncated",
+	"SymlinkRetargeted",
+	"WaitingForFile",
+	"ReachedEOF",
+	"Stopped",
+}
+
+func (t EventType) String() string {
+	if t < 0 || int(t) >= len(eventTypeNames) {
+		return "EventType(" + strconv.Itoa(int(t)) + ")"
+	}
+	return eventTypeNames[t]
+}
+
+// Event is a lifecycle event of a tail, for Config.Events.
+type Event struct {
+	Type     EventType
+	Filename string
+	FileID   FileID // Identity of the file concerned, if open and known
+	Offset   int64  // Read position in the file
+	Size     int64  // Size of the file, if open
+	Err      error  // Reason of Stopped
+	Time     time.Time
+}
+
+// event fills in e with the current file and passes it to Config.Events.
+func (tail *Tail) event(e Event) {
+	if tail.Events == nil {
+		return
+	}
+	e.Filename = tail.Filename
+	e.Time = time.Now()
+	if tail.File != nil {
+		e.FileID = tail.id
+		if e.Size == 0 && !tail.Pipe {
+			e.Size = tail.fileSize()
+		}
+	}
+	if e.Type == Stopped {
+		e.Err = tail.Err()
+		if e.Err == tomb.ErrStillAlive || e.Err == errStopAtEOF {
+			e.Err = nil
+		}
+	}
+	tail.Events(e)
+}
+
+// readOffset returns the position read up to, as last seen by readLines.
+func (tail *Tail) readOffset() int64 {
+	return atomic.LoadInt64(&tail.stats.offset)
+}
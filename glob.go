@@ -0,0 +1,250 @@
+package tail
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pavamana1123/tail/watch"
+	"gopkg.in/tomb.v1"
+)
+
+// MultiTail tails every file matching a glob pattern. Lines from all the
+// files are sent to a single channel, tagged with their Filename.
+type MultiTail struct {
+	Pattern string
+	Lines   chan *Line
+	Config
+
+	tomb.Tomb // provides: Done, Kill, Dying
+
+	log    Logger
+	mu     sync.Mutex
+	tails  map[string]*Tail
+	wg     sync.WaitGroup // forwarding goroutines, one per tail
+	rescan chan bool
+}
+
+// TailGlob begins tailing the files matching pattern, using the syntax of
+// filepath.Match. With Follow, files that start matching later are tailed
+// from their beginning as they appear, and files that are deleted or
+// renamed stop being tailed; rotated files are thus followed by name
+// through the pattern, and ReOpen is ignored. When PosFile is set, it
+// names a directory holding the position file of each tailed file; the
+// queue of each file, with Queue set, is likewise a subdirectory of
+// Queue.Dir.
+func TailGlob(pattern string, config Config) (*MultiTail, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	if config.PosFile != "" {
+		if err := os.MkdirAll(config.PosFile, 0755); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &MultiTail{
+		Pattern: pattern,
+		Lines:   make(chan *Line),
+		Config:  config,
+		tails:   make(map[string]*Tail),
+		rescan:  make(chan bool, 1),
+	}
+	if m.Logger == nil {
+		m.Logger = DefaultLogger
+	}
+	m.log = m.Log
+	if m.log == nil {
+		m.log = NewStdLogger(m.Logger)
+	}
+
+	go m.run()
+
+	return m, nil
+}
+
+// Commit acknowledges that line has been processed; see Tail.Commit.
+// Lines sent before their file was tailed again, once recreated, are no
+// longer pending.
+func (m *MultiTail) Commit(line *Line) error {
+	m.mu.Lock()
+	t := m.tails[line.Filename]
+	m.mu.Unlock()
+
+	if t == nil || t != line.tail {
+		return ErrNotPending
+	}
+	return t.Commit(line)
+}
+
+// Stats returns the Stats of the files being tailed, by Filename.
+func (m *MultiTail) Stats() []Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := make([]string, 0, len(m.tails))
+	for name := range m.tails {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	stats := make([]Stats, len(names))
+	for i, name := range names {
+		stats[i] = m.tails[name].Stats()
+	}
+	return stats
+}
+
+// Stop stops tailing all the files.
+func (m *MultiTail) Stop() error {
+	m.Kill(nil)
+	return m.Wait()
+}
+
+func (m *MultiTail) run() {
+	defer m.close()
+
+	m.scan(m.Location)
+	if !m.Follow {
+		m.wg.Wait()
+		return
+	}
+
+	var poll <-chan time.Time
+	if m.Poll || !m.watchDirs() {
+		ticker := time.NewTicker(watch.POLL_DURATION)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-m.rescan:
+		case <-poll:
+		case <-m.Dying():
+			return
+		}
+		m.scan(nil)
+	}
+}
+
+// watchDirs asks inotify to report files created in the directories the
+// pattern may match. It returns false if those cannot be watched.
+func (m *MultiTail) watchDirs() bool {
+	dirs, _ := filepath.Glob(filepath.Dir(m.Pattern))
+	if len(dirs) == 0 {
+		return false
+	}
+	for _, dir := range dirs {
+		if err := watch.WatchDir(dir); err != nil {
+			m.log.Warn("Cannot watch directory, polling instead", "dir", dir, "err", err)
+			return false
+		}
+		go func(dir string) {
+			<-m.Dying()
+			watch.RemoveWatchDir(dir)
+		}(dir)
+		events := watch.DirEvents(dir)
+		go func() {
+			for range events {
+				m.requestScan()
+			}
+		}()
+	}
+	return true
+}
+
+func (m *MultiTail) requestScan() {
+	select {
+	case m.rescan <- true:
+	default:
+	}
+}
+
+// scan starts tailing the files matching the pattern that are not tailed
+// yet, seeking to location.
+func (m *MultiTail) scan(location *SeekInfo) {
+	matches, _ := filepath.Glob(m.Pattern)
+	for _, name := range matches {
+		m.mu.Lock()
+		_, tailed := m.tails[name]
+		m.mu.Unlock()
+		if tailed {
+			continue
+		}
+		if fi, err := os.Stat(name); err != nil || fi.IsDir() {
+			continue
+		}
+
+		config := m.Config
+		config.Location = location
+		config.ReOpen = false
+		config.MustExist = true
+		config.Log = m.log
+		if m.PosFile != "" {
+			config.PosFile = filepath.Join(m.PosFile, url.QueryEscape(name)+".pos")
+		}
+		if m.Queue != nil {
+			queue := *m.Queue
+			queue.Dir = filepath.Join(m.Queue.Dir, url.QueryEscape(name))
+			config.Queue = &queue
+		}
+		t, err := TailFile(name, config)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				m.log.Error("Unable to tail file", "file", name, "err", err)
+			}
+			continue
+		}
+
+		m.mu.Lock()
+		m.tails[name] = t
+		m.mu.Unlock()
+		m.wg.Add(1)
+		go m.forward(name, t)
+	}
+}
+
+// forward sends the lines of t to the Lines channel until t stops.
+func (m *MultiTail) forward(name string, t *Tail) {
+	defer m.wg.Done()
+
+	go func() {
+		select {
+		case <-m.Dying():
+			t.Kill(nil)
+		case <-t.Dead():
+		}
+	}()
+
+	// once dying, drop lines until t closes its channel
+	for line := range t.Lines {
+		select {
+		case m.Lines <- line:
+		case <-m.Dying():
+		}
+	}
+	err := t.Wait()
+
+	m.mu.Lock()
+	delete(m.tails, name)
+	m.mu.Unlock()
+
+	if err != nil && err != errStopAtEOF {
+		select {
+		case m.Lines <- &Line{Text: []byte(err.Error()), Err: err, Filename: name, Time: time.Now()}:
+		case <-m.Dying():
+		}
+	}
+	// a new file may have appeared under the same name meanwhile
+	m.requestScan()
+}
+
+func (m *MultiTail) close() {
+	m.Kill(nil)
+	m.wg.Wait()
+	close(m.Lines)
+	m.Done()
+}
@@ -0,0 +1,183 @@
+package tail
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrLineLocationWithSplit is returned by TailFile when Config.LineLocation
+// is set along with Config.Split, which cannot be used to count lines.
+var ErrLineLocationWithSplit = errors.New("tail: cannot set LineLocation with Split")
+
+// LineLocation is a start position counted in lines, like the arguments
+// of tail -n.
+type LineLocation struct {
+	Lines     int64 // Start at the last Lines lines
+	FromStart bool  // Start at line number Lines instead, counting from 1 (tail -n +Lines)
+}
+
+// lineBlockSize is the size of the blocks read to count lines.
+const lineBlockSize = 64 * 1024
+
+// lineOffset returns the offset of the line loc refers to in the input,
+// which is positioned at its start. The input is left positioned anywhere.
+func (tail *Tail) lineOffset(loc *LineLocation) (int64, error) {
+	tail.detectEncoding()
+	delim, _ := tail.delimiter()
+	unit := int64(tail.unit())
+
+	input := tail.input()
+	start, err := input.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return 0, err
+	}
+
+	if loc.FromStart {
+		if loc.Lines <= 1 {
+			return start, nil
+		}
+		n := int64(0)
+		return scanDelimiters(input, start, delim, unit, func(int64) bool {
+			n++
+			return n < loc.Lines-1
+		})
+	}
+
+	if tail.decompressed != nil {
+		return lastLinesForward(input, start, loc.Lines, delim, unit)
+	}
+	fi, err := tail.File.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return lastLinesBackward(tail.File, start, fi.Size(), loc.Lines, delim, unit)
+}
+
+// lastLinesBackward returns the offset of the last n lines of f, between
+// start and size, scanning backward from the end in blocks. A last line
+// without delimiter counts as a line.
+func lastLinesBackward(f io.ReaderAt, start, size, n int64, delim []byte, unit int64) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+	d := int64(len(delim))
+
+	// the delimiter ending the file terminates the last line
+	end := size
+	if end-start >= d && end%unit == 0 {
+		buf := make([]byte, d)
+		if _, err := f.ReadAt(buf, end-d); err != nil {
+			return 0, err
+		}
+		if bytes.Equal(buf, delim) {
+			end -= d
+		}
+	}
+
+	count := int64(0)
+	for hi := end; hi > start; {
+		lo := hi - lineBlockSize
+		if lo < start {
+			lo = start
+		}
+		// read past hi for delimiters starting before it
+		readEnd := hi + d - 1
+		if readEnd > end {
+			readEnd = end
+		}
+		buf := make([]byte, readEnd-lo)
+		if _, err := f.ReadAt(buf, lo); err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		for j := len(buf); ; {
+			i := bytes.LastIndex(buf[:j], delim)
+			if i < 0 {
+				break
+			}
+			if (lo+int64(i))%unit == 0 {
+				count++
+				if count == n {
+					return lo + int64(i) + d, nil
+				}
+			}
+			j = i + int(d) - 1
+		}
+		hi = lo
+	}
+	return start, nil
+}
+
+// lastLinesForward is like lastLinesBackward for inputs that can only be
+// read forward, from start.
+func lastLinesForward(r io.Reader, start, n int64, delim []byte, unit int64) (int64, error) {
+	// starts of the lines seen last
+	starts := []int64{start}
+	end, err := scanDelimiters(r, start, delim, unit, func(end int64) bool {
+		starts = append(starts, end)
+		if len(starts) > 2*(int(n)+1) {
+			starts = append(starts[:0], starts[len(starts)-int(n)-1:]...)
+		}
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return end, nil
+	}
+
+	// the delimiter ending the input terminates the last line
+	if starts[len(starts)-1] == end && len(starts) > 1 {
+		starts = starts[:len(starts)-1]
+	}
+	if int64(len(starts)) <= n {
+		return starts[0], nil
+	}
+	return starts[int64(len(starts))-n], nil
+}
+
+// scanDelimiters reads r, positioned at offset start, and calls fn with
+// the offset following each delimiter at a code unit boundary, until fn
+// returns false. It returns the offset it stopped at.
+func scanDelimiters(r io.Reader, start int64, delim []byte, unit int64, fn func(end int64) bool) (int64, error) {
+	d := len(delim)
+	buf := make([]byte, lineBlockSize+d)
+	base := start // offset of buf[0]
+	kept := 0     // bytes kept from the previous block
+	for {
+		n, err := r.Read(buf[kept:])
+		data := buf[:kept+n]
+		for off := 0; ; {
+			i := bytes.Index(data[off:], delim)
+			if i < 0 {
+				break
+			}
+			pos := base + int64(off+i)
+			if pos%unit == 0 {
+				if !fn(pos + int64(d)) {
+					return pos + int64(d), nil
+				}
+				off += i + d
+			} else {
+				off += i + 1
+			}
+		}
+		if err == io.EOF {
+			return base + int64(len(data)), nil
+		}
+		if err != nil {
+			return base + int64(len(data)), err
+		}
+
+		// keep what may be the start of a delimiter
+		kept = d - 1
+		if kept > len(data) {
+			kept = len(data)
+		}
+		copy(buf, data[len(data)-kept:])
+		base += int64(len(data) - kept)
+	}
+}
@@ -0,0 +1,146 @@
+package tail
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// DefaultMultilineTimeout is used when Multiline.Timeout is zero.
+var DefaultMultilineTimeout = time.Second
+
+// ErrInvalidMultiline is returned by TailFile when Config.Multiline has
+// no rule to group lines by.
+var ErrInvalidMultiline = errors.New("tail: Multiline needs Start, Continue or Indented")
+
+// Multiline groups consecutive lines into events, such as stack traces,
+// which are sent as single lines joined by "\n". When Continue or Indented
+// is set, lines matching them continue the current event, and other lines
+// start a new one; otherwise, lines not matching Start continue it. Lines
+// matching Start always start a new event.
+type Multiline struct {
+	Start    *regexp.Regexp // Lines matching Start begin an event
+	Continue *regexp.Regexp // Lines matching Continue are part of the current event
+	Indented bool           // Lines starting with a space or tab are part of the current event
+	End      *regexp.Regexp // Lines matching End complete the current event
+
+	// Lines past MaxLines or bytes past MaxBytes are dropped from an
+	// event, which is then marked Truncated (0: no limit)
+	MaxLines int
+	MaxBytes int
+
+	// Timeout is how long to wait for more lines before sending the
+	// current event (default: DefaultMultilineTimeout)
+	Timeout time.Duration
+}
+
+// multiline holds the event being grouped by a tail.
+type multiline struct {
+	*Multiline
+	event *Line     // nil if no event is pending
+	lines int       // number of lines in event
+	last  time.Time // when the last line was added
+}
+
+// continues reports whether text is part of the current event.
+func (m *multiline) continues(text []byte) bool {
+	if m.Start != nil && m.Start.Match(text) {
+		return false
+	}
+	if m.Continue == nil && !m.Indented {
+		return true
+	}
+	if m.Continue != nil && m.Continue.Match(text) {
+		return true
+	}
+	return m.Indented && len(text) > 0 && (text[0] == ' ' || text[0] == '\t')
+}
+
+// add adds l to the current event, or starts a new one with it, and
+// returns the events that are complete.
+func (m *multiline) add(l *Line) []*Line {
+	var done []*Line
+	joined := m.event != nil && m.event.Partial
+	if m.event != nil && !joined && !m.continues(l.Text) {
+		done = append(done, m.flush())
+	}
+	m.last = time.Now()
+
+	if m.event == nil {
+		m.event = l
+		m.lines = 1
+		m.cap()
+	} else {
+		text := l.Text
+		if !joined {
+			m.lines++
+			text = append([]byte{'\n'}, text...)
+		}
+		if m.MaxLines > 0 && m.lines > m.MaxLines {
+			m.event.Truncated = true
+		} else {
+			m.event.Text = append(m.event.Text, text...)
+			m.event.Truncated = m.event.Truncated || l.Truncated
+			m.cap()
+		}
+		m.event.EndOffset = l.EndOffset
+		m.event.Partial = l.Partial
+	}
+
+	if !l.Partial && m.End != nil && m.End.Match(l.Text) {
+		done = append(done, m.flush())
+	}
+	return done
+}
+
+// cap enforces MaxBytes on the current event.
+func (m *multiline) cap() {
+	if m.MaxBytes > 0 && len(m.event.Text) > m.MaxBytes {
+		m.event.Text = m.event.Text[:m.MaxBytes]
+		m.event.Truncated = true
+	}
+}
+
+// flush returns the current event, if any, and forgets it.
+func (m *multiline) flush() *Line {
+	event := m.event
+	m.event = nil
+	if event != nil {
+		event.Partial = false
+		event.Part = 0
+	}
+	return event
+}
+
+// timeout returns a channel receiving when the current event is due to
+// be sent, or nil if there is none.
+func (m *multiline) timeout() <-chan time.Time {
+	if m == nil || m.event == nil {
+		return nil
+	}
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DefaultMultilineTimeout
+	}
+	return time.After(timeout - time.Since(m.last))
+}
+
+// sendEvent sends the pending multiline event, if any.
+func (tail *Tail) sendEvent() bool {
+	if tail.multiline == nil {
+		return true
+	}
+	if event := tail.multiline.flush(); event != nil {
+		return tail.deliver(event)
+	}
+	return true
+}
+
+// sentUpTo returns the offset up to which the input has been sent, given
+// the read position: the start of the pending multiline event, if any.
+func (tail *Tail) sentUpTo(offset int64) int64 {
+	if tail.multiline != nil && tail.multiline.event != nil {
+		return tail.multiline.event.Offset
+	}
+	return offset
+}
@@ -0,0 +1,185 @@
+package tail
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// OverflowPolicy selects what happens to lines read while the Lines
+// channel is full, with Config.BufferSize lines waiting for the consumer.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops reading until the consumer takes a line.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest line waiting in the channel to
+	// make room.
+	OverflowDropOldest
+	// OverflowDropNewest drops the line read.
+	OverflowDropNewest
+	// OverflowSpill writes lines to a file in Config.SpillDir until the
+	// consumer catches up, and keeps reading. Spilled lines keep the
+	// message of their Err only, and their Fields are restored as
+	// decoded by encoding/json.
+	OverflowSpill
+)
+
+// QueueStats describes the lines waiting for the consumer of a tail.
+type QueueStats struct {
+	Depth    int           // Lines waiting in the Lines channel, spilled or in Config.Queue
+	Capacity int           // Config.BufferSize
+	Dropped  uint64        // Lines dropped by OverflowDropOldest and OverflowDropNewest
+	Spilled  uint64        // Lines spilled by OverflowSpill
+	Blocked  time.Duration // Time spent waiting for the consumer
+}
+
+// queueStats holds the counters of QueueStats, accessed atomically.
+type queueStats struct {
+	dropped uint64
+	spilled uint64
+	blocked int64
+}
+
+// QueueStats returns the state of the queue of lines waiting for the
+// consumer. It is safe to call from any goroutine.
+func (tail *Tail) QueueStats() QueueStats {
+	stats := QueueStats{
+		Depth:    len(tail.Lines),
+		Capacity: cap(tail.Lines),
+		Dropped:  atomic.LoadUint64(&tail.queue.dropped),
+		Spilled:  atomic.LoadUint64(&tail.queue.spilled),
+		Blocked:  time.Duration(atomic.LoadInt64(&tail.queue.blocked)),
+	}
+	if tail.disk != nil {
+		stats.Depth += tail.disk.len()
+	}
+	return stats
+}
+
+// enqueue sends l to the Lines channel, as set by Config.Overflow when it
+// is full, or queues it in Config.Queue.
+func (tail *Tail) enqueue(l *Line) {
+	if tail.cursor != nil {
+		if err := tail.disk.push(l); err != nil {
+			tail.Killf("Unable to queue lines of %s: %s", tail.Filename, err)
+		}
+		return
+	}
+	if tail.disk != nil && tail.disk.len() > 0 {
+		// keep the order of lines
+		tail.spillLine(l)
+		return
+	}
+	select {
+	case tail.Lines <- l:
+		return
+	default:
+	}
+
+	switch tail.Overflow {
+	case OverflowDropOldest:
+		if cap(tail.Lines) == 0 {
+			// no line is waiting
+			tail.dropLine(l)
+			return
+		}
+		for {
+			select {
+			case old := <-tail.Lines:
+				tail.dropLine(old)
+			default:
+			}
+			select {
+			case tail.Lines <- l:
+				return
+			default:
+			}
+		}
+	case OverflowDropNewest:
+		tail.dropLine(l)
+	case OverflowSpill:
+		tail.spillLine(l)
+	default:
+		start := time.Now()
+		tail.Lines <- l
+		atomic.AddInt64(&tail.queue.blocked, int64(time.Since(start)))
+	}
+}
+
+// dropLine counts l as dropped, and as processed for ExplicitCommit.
+func (tail *Tail) dropLine(l *Line) {
+	atomic.AddUint64(&tail.queue.dropped, 1)
+	if tail.checkpoint != nil && tail.ExplicitCommit {
+		tail.checkpoint.commit(l)
+	}
+}
+
+// spillLine spills l to disk, or waits for the consumer to take the
+// spilled lines and sends it if it cannot be.
+func (tail *Tail) spillLine(l *Line) {
+	err := tail.disk.push(l)
+	if err == nil {
+		atomic.AddUint64(&tail.queue.spilled, 1)
+		return
+	}
+	tail.log.Error("Failed to spill lines", "file", tail.Filename, "err", err)
+	start := time.Now()
+	tail.disk.wait()
+	tail.Lines <- l
+	atomic.AddInt64(&tail.queue.blocked, int64(time.Since(start)))
+}
+
+// forward sends the lines on disk to the Lines channel. Spilled lines
+// are all sent, and the channel is closed once the tail is done and none
+// are left. Lines of Config.Queue are sent until the tail is stopped, or
+// is done and none are left, and advance the position in the queue.
+func (tail *Tail) forward() {
+	defer close(tail.forwarded)
+	if tail.cursor == nil {
+		defer close(tail.Lines)
+		defer tail.disk.shutdown()
+	}
+	for {
+		l, end, ok := tail.disk.peek()
+		if !ok {
+			return
+		}
+		if lost := tail.disk.takeLost(); lost > 0 {
+			err := &QueueEvictionError{Lost: lost}
+			if !tail.forwardLine(&Line{Text: []byte(err.Error()), Err: err, Filename: tail.Filename, Time: time.Now()}) {
+				return
+			}
+		}
+		// decoded from disk, which does not keep the tail
+		l.tail = tail
+		if tail.cursor != nil && tail.ExplicitCommit {
+			tail.cursor.track(l, position{Offset: end})
+		}
+		if !tail.forwardLine(l) {
+			return
+		}
+		tail.disk.pop()
+		if tail.cursor != nil && !tail.ExplicitCommit {
+			tail.cursor.set(position{Offset: end})
+			tail.disk.discard(end)
+		}
+	}
+}
+
+// forwardLine sends l to the Lines channel. It returns false if the tail
+// is stopped first, which leaves the lines of Config.Queue to the next
+// tail.
+func (tail *Tail) forwardLine(l *Line) bool {
+	if tail.cursor != nil {
+		select {
+		case tail.Lines <- l:
+			return true
+		case <-tail.Dying():
+			if tail.Err() != errStopAtEOF {
+				return false
+			}
+		}
+	}
+	tail.Lines <- l
+	return true
+}
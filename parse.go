@@ -0,0 +1,290 @@
+package tail
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseFunc parses the text of a line into fields, for Config.Parse.
+// Fields it returns along with an error are kept.
+type ParseFunc func(text []byte) (map[string]interface{}, error)
+
+// ParseError is the Err of lines that Config.Parse failed to parse.
+type ParseError struct {
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return "parse error: " + e.Err.Error()
+}
+
+// parse sets the fields of l, which is complete, with Config.Parse.
+func (tail *Tail) parse(l *Line) {
+	if tail.Parse == nil || l.Partial {
+		return
+	}
+	fields, err := tail.Parse(l.Text)
+	l.Fields = fields
+	if err != nil && l.Err == nil {
+		l.Err = &ParseError{Err: err}
+	}
+}
+
+// ParseJSON parses lines that are JSON objects, as decoded by
+// encoding/json.
+func ParseJSON(text []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(text, &fields); err != nil {
+		return nil, err
+	}
+	if fields == nil {
+		return nil, errors.New("not a JSON object")
+	}
+	return fields, nil
+}
+
+// ParseLogfmt parses lines of key=value pairs separated by spaces, where
+// values may be quoted strings. Values are strings, but for keys without
+// value, which are true.
+func ParseLogfmt(text []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	s := string(text)
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return fields, nil
+		}
+
+		i := strings.IndexAny(s, "= \t")
+		if i < 0 {
+			i = len(s)
+		}
+		key := s[:i]
+		if key == "" {
+			return fields, fmt.Errorf("logfmt: missing key at %q", s)
+		}
+		s = s[i:]
+		if !strings.HasPrefix(s, "=") {
+			fields[key] = true
+			continue
+		}
+		s = s[1:]
+
+		if !strings.HasPrefix(s, `"`) {
+			i := strings.IndexAny(s, " \t")
+			if i < 0 {
+				i = len(s)
+			}
+			fields[key] = s[:i]
+			s = s[i:]
+			continue
+		}
+		// quoted value: find the closing quote
+		end := 1
+		for end < len(s) && s[end] != '"' {
+			if s[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s) {
+			return fields, fmt.Errorf("logfmt: unterminated value of %s", key)
+		}
+		value, err := strconv.Unquote(s[:end+1])
+		if err != nil {
+			return fields, fmt.Errorf("logfmt: invalid value of %s: %s", key, err)
+		}
+		fields[key] = value
+		s = s[end+1:]
+	}
+}
+
+// ParseRegexp returns a ParseFunc setting the named groups of re as
+// fields; lines not matching re fail to parse.
+func ParseRegexp(re *regexp.Regexp) ParseFunc {
+	names := re.SubexpNames()
+	return func(text []byte) (map[string]interface{}, error) {
+		m := re.FindSubmatchIndex(text)
+		if m == nil {
+			return nil, fmt.Errorf("no match for %s", re)
+		}
+		fields := make(map[string]interface{})
+		for i, name := range names {
+			if name != "" && m[2*i] >= 0 {
+				fields[name] = string(text[m[2*i]:m[2*i+1]])
+			}
+		}
+		return fields, nil
+	}
+}
+
+var combinedLog = regexp.MustCompile(
+	`^(\S+) (\S+) (\S+) \[([^\]]+)\] "((\S+) (\S+)(?: (\S+))?|[^"]*)" (\d{3}) (\d+|-)(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// ParseCombinedLog parses the access logs of web servers, in the Common
+// or Combined Log Format of Apache and nginx, into remote_addr, ident,
+// user, time (a time.Time), request, method, path, protocol, status and
+// bytes (ints), referer and user_agent. Fields logged as "-" are left out.
+func ParseCombinedLog(text []byte) (map[string]interface{}, error) {
+	m := combinedLog.FindSubmatch(text)
+	if m == nil {
+		return nil, errors.New("not in the Common or Combined Log Format")
+	}
+	fields := make(map[string]interface{})
+	set := func(key string, value []byte) {
+		if len(value) > 0 && string(value) != "-" {
+			fields[key] = string(value)
+		}
+	}
+	set("remote_addr", m[1])
+	set("ident", m[2])
+	set("user", m[3])
+	set("request", m[5])
+	set("method", m[6])
+	set("path", m[7])
+	set("protocol", m[8])
+	set("referer", m[11])
+	set("user_agent", m[12])
+
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", string(m[4]))
+	if err != nil {
+		return fields, err
+	}
+	fields["time"] = t
+	fields["status"], _ = strconv.Atoi(string(m[9]))
+	if n, err := strconv.Atoi(string(m[10])); err == nil {
+		fields["bytes"] = n
+	}
+	return fields, nil
+}
+
+// ParseSyslog parses syslog messages, in the format of RFC 5424 or RFC 3164
+// (BSD syslog, as written to files, with or without priority), into
+// priority, facility and severity (ints), timestamp (a time.Time),
+// hostname, app_name, proc_id, msg_id, structured_data and message.
+// Fields logged as "-" are left out. RFC 3164 timestamps, which have no
+// year, are taken in the current year, in local time.
+func ParseSyslog(text []byte) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+	s := string(text)
+
+	if strings.HasPrefix(s, "<") {
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return nil, errors.New("syslog: unterminated priority")
+		}
+		pri, err := strconv.Atoi(s[1:end])
+		if err != nil || pri < 0 || pri > 191 {
+			return nil, fmt.Errorf("syslog: invalid priority %q", s[1:end])
+		}
+		fields["priority"] = pri
+		fields["facility"] = pri / 8
+		fields["severity"] = pri % 8
+		s = s[end+1:]
+
+		if strings.HasPrefix(s, "1 ") {
+			return fields, parseRFC5424(s[2:], fields)
+		}
+	}
+	return fields, parseRFC3164(s, fields)
+}
+
+// parseRFC5424 parses what follows the version of an RFC 5424 message.
+func parseRFC5424(s string, fields map[string]interface{}) error {
+	header := strings.SplitN(s, " ", 6)
+	if len(header) < 6 {
+		return errors.New("syslog: truncated header")
+	}
+	if header[0] != "-" {
+		t, err := time.Parse(time.RFC3339Nano, header[0])
+		if err != nil {
+			return fmt.Errorf("syslog: invalid timestamp %q", header[0])
+		}
+		fields["timestamp"] = t
+	}
+	for i, key := range []string{"hostname", "app_name", "proc_id", "msg_id"} {
+		if header[i+1] != "-" {
+			fields[key] = header[i+1]
+		}
+	}
+
+	s = header[5]
+	if strings.HasPrefix(s, "-") {
+		s = s[1:]
+	} else if strings.HasPrefix(s, "[") {
+		end := structuredDataEnd(s)
+		if end < 0 {
+			return errors.New("syslog: unterminated structured data")
+		}
+		fields["structured_data"] = s[:end]
+		s = s[end:]
+	} else {
+		return errors.New("syslog: missing structured data")
+	}
+	if s = strings.TrimPrefix(s, " "); s != "" {
+		fields["message"] = strings.TrimPrefix(s, "\ufeff") // BOM of UTF-8 messages
+	}
+	return nil
+}
+
+// structuredDataEnd returns the index following the structured data
+// elements starting s, or -1.
+func structuredDataEnd(s string) int {
+	i := 0
+	for i < len(s) && s[i] == '[' {
+		quoted := false
+		for i++; i < len(s); i++ {
+			if quoted && s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				quoted = !quoted
+			} else if !quoted && s[i] == ']' {
+				break
+			}
+		}
+		if i >= len(s) {
+			return -1
+		}
+		i++
+	}
+	return i
+}
+
+// parseRFC3164 parses a BSD syslog message, without its priority.
+func parseRFC3164(s string, fields map[string]interface{}) error {
+	const layout = "Jan _2 15:04:05"
+	if len(s) < len(layout) {
+		return errors.New("syslog: missing timestamp")
+	}
+	t, err := time.ParseInLocation(layout, s[:len(layout)], time.Local)
+	if err != nil {
+		return fmt.Errorf("syslog: invalid timestamp %q", s[:len(layout)])
+	}
+	fields["timestamp"] = t.AddDate(time.Now().Year(), 0, 0)
+	s = strings.TrimPrefix(s[len(layout):], " ")
+
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return errors.New("syslog: missing hostname")
+	}
+	fields["hostname"] = s[:i]
+	s = s[i+1:]
+
+	// TAG[PID]: MSG, where the tag is optional
+	if i := strings.Index(s, ": "); i >= 0 && !strings.ContainsAny(s[:i], " ") {
+		tag := s[:i]
+		if j := strings.IndexByte(tag, '['); j >= 0 && strings.HasSuffix(tag, "]") {
+			fields["proc_id"] = tag[j+1 : len(tag)-1]
+			tag = tag[:j]
+		}
+		fields["app_name"] = tag
+		s = s[i+2:]
+	}
+	fields["message"] = s
+	return nil
+}
@@ -0,0 +1,44 @@
+package tail
+
+import "time"
+
+// partialIdle reports whether the last line of the file, read up to the
+// read position without its delimiter, has not grown for
+// Config.PartialLineTimeout.
+func (tail *Tail) partialIdle() bool {
+	if tail.PartialLineTimeout <= 0 || tail.Pipe {
+		return false
+	}
+	end, err := tail.Tell()
+	if err != nil {
+		return false
+	}
+	if tail.partialSince.IsZero() || end != tail.partialEnd {
+		tail.partialEnd = end
+		tail.partialSince = time.Now()
+		return false
+	}
+	return time.Since(tail.partialSince) >= tail.PartialLineTimeout
+}
+
+// sendPartial sends the last line of the file, which has no delimiter yet.
+// The rest of the line is sent as its next parts with ContinuePartialLines,
+// and as a new line otherwise.
+func (tail *Tail) sendPartial(l *Line, offset, end int64) bool {
+	tail.partialSince = time.Time{}
+	l.Partial = true
+	ok := tail.sendLine(l, offset, end)
+	if !tail.ContinuePartialLines {
+		tail.part = 0
+	}
+	return ok
+}
+
+// partialTimeout returns a channel receiving when the last line of the
+// file is due to be sent by PartialLineTimeout, or nil if there is none.
+func (tail *Tail) partialTimeout() <-chan time.Time {
+	if tail.partialSince.IsZero() {
+		return nil
+	}
+	return time.After(tail.PartialLineTimeout - time.Since(tail.partialSince))
+}
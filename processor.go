@@ -0,0 +1,139 @@
+package tail
+
+import (
+	"fmt"
+	"regexp"
+	"sync/atomic"
+)
+
+// Processor filters or transforms lines before they are sent, for
+// Config.Processors. Lines dropped by processors do not count against
+// the rate limit, and are checkpointed as processed.
+type Processor interface {
+	// Process returns the line to send, l itself or another, or nil to
+	// drop it. It is called with lines, multiline events, and the parts
+	// of long lines, after Config.Parse.
+	Process(l *Line) *Line
+}
+
+// ProcessorFunc is a function usable as a Processor.
+type ProcessorFunc func(l *Line) *Line
+
+// Process returns f(l).
+func (f ProcessorFunc) Process(l *Line) *Line {
+	return f(l)
+}
+
+// process runs l through Config.Processors, and returns the line to send
+// or nil.
+func (tail *Tail) process(l *Line) *Line {
+	for _, p := range tail.Processors {
+		if l = p.Process(l); l == nil {
+			return nil
+		}
+	}
+	return l
+}
+
+// Filter returns a Processor sending the lines keep returns true for.
+func Filter(keep func(l *Line) bool) Processor {
+	return ProcessorFunc(func(l *Line) *Line {
+		if keep(l) {
+			return l
+		}
+		return nil
+	})
+}
+
+// Include returns a Processor sending the lines matching re.
+func Include(re *regexp.Regexp) Processor {
+	return Filter(func(l *Line) bool { return re.Match(l.Text) })
+}
+
+// Exclude returns a Processor dropping the lines matching re.
+func Exclude(re *regexp.Regexp) Processor {
+	return Filter(func(l *Line) bool { return !re.Match(l.Text) })
+}
+
+// FieldMatches returns a Processor sending the lines with the named field,
+// formatted by fmt.Sprint, matching re.
+func FieldMatches(name string, re *regexp.Regexp) Processor {
+	return Filter(func(l *Line) bool {
+		v, ok := l.Fields[name]
+		return ok && re.MatchString(fmt.Sprint(v))
+	})
+}
+
+// Sample returns a Processor sending one line in n, starting with the
+// first. Tails sharing it, such as those of TailGlob, sample their lines
+// together.
+func Sample(n int) Processor {
+	var count uint64
+	return Filter(func(l *Line) bool {
+		return n <= 1 || (atomic.AddUint64(&count, 1)-1)%uint64(n) == 0
+	})
+}
+
+// Redact returns a Processor replacing the matches of re in the text of
+// lines, and in their string fields, by repl, as done by
+// regexp.ReplaceAll.
+func Redact(re *regexp.Regexp, repl string) Processor {
+	return ProcessorFunc(func(l *Line) *Line {
+		l.Text = re.ReplaceAll(l.Text, []byte(repl))
+		for k, v := range l.Fields {
+			if s, ok := v.(string); ok {
+				l.Fields[k] = re.ReplaceAllString(s, repl)
+			}
+		}
+		return l
+	})
+}
+
+var (
+	cardNumber  = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	bearerToken = regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`)
+)
+
+// RedactSecrets is a Processor replacing secrets in the text of lines, and
+// in their string fields, by "[REDACTED]": payment card numbers, which
+// pass the Luhn check, and bearer tokens.
+var RedactSecrets Processor = ProcessorFunc(func(l *Line) *Line {
+	l.Text = redactSecrets(l.Text)
+	for k, v := range l.Fields {
+		if s, ok := v.(string); ok {
+			l.Fields[k] = string(redactSecrets([]byte(s)))
+		}
+	}
+	return l
+})
+
+func redactSecrets(b []byte) []byte {
+	b = cardNumber.ReplaceAllFunc(b, func(m []byte) []byte {
+		if luhn(m) {
+			return []byte("[REDACTED]")
+		}
+		return m
+	})
+	return bearerToken.ReplaceAll(b, []byte("${1}[REDACTED]"))
+}
+
+// luhn reports whether the digits of b pass the Luhn check.
+func luhn(b []byte) bool {
+	sum := 0
+	double := false
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < '0' || b[i] > '9' {
+			continue
+		}
+		d := int(b[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
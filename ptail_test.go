@@ -41,7 +41,7 @@ func TestPSymlinkChange(t *testing.T) {
 	log.Println("Waiting for line1")
 	testLine := <-tHandler.Lines
 
-	if testLine.Text != "line1" {
+	if string(testLine.Text) != "line1" {
 		t.Error("line1 not recieved")
 		t.Fail()
 	} else {
@@ -56,7 +56,7 @@ func TestPSymlinkChange(t *testing.T) {
 	log.Println("Symlink changed...waiting to detect")
 	log.Println("Waiting for line2")
 	testLine = <-tHandler.Lines
-	if testLine.Text != "line2" {
+	if string(testLine.Text) != "line2" {
 		t.Error("line2 not recieved")
 		t.Fail()
 	} else {
@@ -83,7 +83,7 @@ func TestXNoLogLossAfterSymLinkChange(t *testing.T) {
 
 	testLine := <-tHandler.Lines
 
-	if testLine.Text != "line1" {
+	if string(testLine.Text) != "line1" {
 		t.Error("line1 not recieved")
 		t.Fail()
 	} else {
@@ -96,7 +96,7 @@ func TestXNoLogLossAfterSymLinkChange(t *testing.T) {
 	go func() {
 		for i := 0; i < 1000; i++ {
 			testLine = <-tHandler.Lines
-			if testLine.Text != strconv.Itoa(i) {
+			if string(testLine.Text) != strconv.Itoa(i) {
 				t.Error("line", i, "not recieved")
 				t.Fail()
 			}
@@ -149,14 +149,14 @@ func TestPNoLogLossAfterBufferOverflow(t *testing.T) {
 
 	for i := 0; i < 2000000-1; i++ {
 		testLine := <-tHandler.Lines
-		if testLine.Text != "A" {
+		if string(testLine.Text) != "A" {
 			t.Error("Line received was not A")
 			t.Fail()
 		}
 	}
 
 	testLine := <-tHandler.Lines
-	if testLine.Text != "B" {
+	if string(testLine.Text) != "B" {
 		t.Error("Last line was not B")
 		t.Fail()
 	}
@@ -360,3 +360,73 @@ func (t TailTest) ReadPosFile(posFile string) string {
 
 	return string(seekPos[0:1])
 }
+
+func TestPPosFileResume(t *testing.T) {
+	tailTest := NewTailTest("pos_file_resume", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	posFile := tailTest.path + "/test.txt.pos"
+
+	// A position saved by an earlier version (bare offset) is honored.
+	tailTest.CreateFile("test.txt.pos", "6")
+	config := Config{Follow: false, PosFile: posFile}
+	tail := tailTest.StartTail("test.txt", config)
+	tailTest.VerifyTailOutput(tail, []string{"world"}, true)
+	tail.Wait()
+
+	pos, err := readPosFile(posFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos == nil || pos.Offset != 12 {
+		t.Fatalf("expected saved position 12, got %+v", pos)
+	}
+
+	// A position saved for another file is ignored.
+	tailTest.CreateFile("test.txt.pos", "6 1 1\n")
+	tail = tailTest.StartTail("test.txt", config)
+	tailTest.done = make(chan struct{})
+	tailTest.VerifyTailOutput(tail, []string{"hello", "world"}, true)
+	tail.Wait()
+	tail.Cleanup()
+}
+
+func TestPExplicitCommit(t *testing.T) {
+	tailTest := NewTailTest("explicit_commit", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\nagain\n")
+	posFile := tailTest.path + "/test.txt.pos"
+	os.Remove(posFile)
+
+	config := Config{Follow: false, PosFile: posFile, ExplicitCommit: true}
+	tail := tailTest.StartTail("test.txt", config)
+	var lines []*Line
+	for line := range tail.Lines {
+		lines = append(lines, line)
+	}
+	tail.Wait()
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+
+	// Committing out of order only advances past the contiguous prefix.
+	if err := tail.Commit(lines[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := tail.Commit(lines[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := tail.Commit(lines[0]); err != ErrNotPending {
+		t.Fatalf("expected ErrNotPending, got %v", err)
+	}
+	if err := tail.checkpoint.flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	pos, err := readPosFile(posFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos == nil || pos.Offset != lines[1].EndOffset || pos.Offset != 12 {
+		t.Fatalf("expected saved position 12, got %+v", pos)
+	}
+	tail.Cleanup()
+}
@@ -0,0 +1,506 @@
+package tail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultQueueSegmentSize is used when Queue.SegmentSize is zero.
+var DefaultQueueSegmentSize int64 = 16 << 20
+
+// Queue configures a persistent queue of the lines read, for
+// Config.Queue. Lines are appended to segment files as they are read,
+// with their offsets in the file tailed, and sent from there to the Lines
+// channel, so that reading never waits for the consumer. Lines queued and
+// not yet sent when the tail stops are sent by the next tail using the
+// queue. Lines are taken as processed once sent, or once committed with
+// ExplicitCommit. Segments are synced to disk before the position saved
+// to PosFile moves past their lines.
+type Queue struct {
+	Dir         string // Directory of the queue, which must not be shared by tails (TailGlob uses subdirectories)
+	SegmentSize int64  // Size of the segment files (0: DefaultQueueSegmentSize)
+
+	// MaxSize, if set, caps the size of the queue: the oldest segments are
+	// evicted past it, whether their lines were sent or not
+	MaxSize int64
+}
+
+// QueueEvictionError is the Err of the lines Tail sends to report that
+// lines were evicted from Config.Queue before being sent.
+type QueueEvictionError struct {
+	Lost int64 // Bytes of lines evicted
+}
+
+func (e *QueueEvictionError) Error() string {
+	return fmt.Sprintf("Queue full; %d bytes of lines evicted", e.Lost)
+}
+
+// diskQueue is a queue of lines in segment files, named after the offset
+// of their first line in the queue. It backs Config.Queue, and
+// OverflowSpill, for which it is not persistent.
+type diskQueue struct {
+	dir         string // for OverflowSpill, the parent of a temporary directory
+	segmentSize int64
+	maxSize     int64
+	persistent  bool
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	segments []int64  // offsets of the segments, oldest first
+	w        *os.File // last segment, nil until written
+	unsynced bool     // w was written since last synced
+	end      int64    // offset of the end of the queue
+	r        *bufio.Reader
+	rf       *os.File // segment read, nil until read
+	next     int64    // offset of the next line to read
+	head     *Line    // decoded by peek, nil if not yet
+	headEnd  int64
+	count    int   // lines after next
+	lost     int64 // bytes evicted unread, to report
+	closed   bool
+}
+
+// openQueue opens the persistent queue of c, to be read from offset
+// start. It returns the largest Line.Num queued.
+func openQueue(c *Queue, start int64) (*diskQueue, uint64, error) {
+	q := newDiskQueue(c.Dir, c.SegmentSize, c.MaxSize)
+	q.persistent = true
+	if err := os.MkdirAll(c.Dir, 0755); err != nil {
+		return nil, 0, err
+	}
+	names, err := filepath.Glob(filepath.Join(c.Dir, "*.seg"))
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, name := range names {
+		off, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), ".seg"), 10, 64)
+		if err == nil {
+			q.segments = append(q.segments, off)
+		}
+	}
+	sort.Sort(int64s(q.segments))
+
+	q.end = start
+	var last []byte
+	if n := len(q.segments); n > 0 {
+		// drop a line partially written before a crash
+		data, err := ioutil.ReadFile(q.segment(q.segments[n-1]))
+		if err != nil {
+			return nil, 0, err
+		}
+		i := bytes.LastIndexByte(data, '\n')
+		if err := os.Truncate(q.segment(q.segments[n-1]), int64(i+1)); err != nil {
+			return nil, 0, err
+		}
+		q.end = q.segments[n-1] + int64(i+1)
+		if i >= 0 {
+			last = data[bytes.LastIndexByte(data[:i], '\n')+1 : i+1]
+		}
+	}
+
+	q.next = start
+	if len(q.segments) > 0 && q.next < q.segments[0] {
+		q.next = q.segments[0]
+	}
+	if q.next > q.end {
+		q.next = q.end
+	}
+	if q.count, err = q.countLines(q.next, q.end); err != nil {
+		return nil, 0, err
+	}
+	q.release(q.next)
+
+	var num uint64
+	if len(last) > 0 {
+		if l, err := decodeLine(last); err == nil {
+			num = l.Num
+		}
+	}
+	return q, num, nil
+}
+
+func newDiskQueue(dir string, segmentSize, maxSize int64) *diskQueue {
+	if segmentSize <= 0 {
+		segmentSize = DefaultQueueSegmentSize
+	}
+	q := &diskQueue{dir: dir, segmentSize: segmentSize, maxSize: maxSize}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+func (q *diskQueue) segment(off int64) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%020d.seg", off))
+}
+
+// segmentOf returns the offset of the segment holding the line at off.
+func (q *diskQueue) segmentOf(off int64) int64 {
+	i := sort.Search(len(q.segments), func(i int) bool { return q.segments[i] > off })
+	if i == 0 {
+		return off
+	}
+	return q.segments[i-1]
+}
+
+// countLines counts the lines between offsets from and to.
+func (q *diskQueue) countLines(from, to int64) (int, error) {
+	n := 0
+	for _, off := range q.segments {
+		if off >= to {
+			break
+		}
+		data, err := ioutil.ReadFile(q.segment(off))
+		if err != nil {
+			return 0, err
+		}
+		lo, hi := from-off, to-off
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > int64(len(data)) {
+			hi = int64(len(data))
+		}
+		if lo < hi {
+			n += bytes.Count(data[lo:hi], []byte{'\n'})
+		}
+	}
+	return n, nil
+}
+
+func (q *diskQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.count
+}
+
+// push appends l to the queue.
+func (q *diskQueue) push(l *Line) error {
+	b, err := encodeLine(l)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.persistent && len(q.segments) == 0 && q.w == nil {
+		dir, err := ioutil.TempDir(q.dir, "tail-spill-")
+		if err != nil {
+			return err
+		}
+		q.dir = dir
+	}
+	if q.w == nil || (q.end > q.segments[len(q.segments)-1] &&
+		q.end-q.segments[len(q.segments)-1]+int64(len(b)) > q.segmentSize) {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	if _, err := q.w.Write(b); err != nil {
+		return err
+	}
+	q.unsynced = true
+	q.end += int64(len(b))
+	q.count++
+	q.evict()
+	q.cond.Broadcast()
+	return nil
+}
+
+// rotate starts writing a new segment, unless the last one is empty.
+func (q *diskQueue) rotate() error {
+	if q.w != nil {
+		if q.persistent && q.unsynced {
+			if err := q.w.Sync(); err != nil {
+				return err
+			}
+			q.unsynced = false
+		}
+		q.w.Close()
+	}
+	n := len(q.segments)
+	if n == 0 || q.segments[n-1] < q.end {
+		q.segments = append(q.segments, q.end)
+	}
+	f, err := os.OpenFile(q.segment(q.segments[len(q.segments)-1]), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		q.w = nil
+		return err
+	}
+	q.w = f
+	return nil
+}
+
+// sync commits the lines queued to disk, so that they survive a crash
+// once the position saved in the file tailed is past them. Earlier
+// segments are synced as they are rotated.
+func (q *diskQueue) sync() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.w == nil || !q.unsynced {
+		return nil
+	}
+	if err := q.w.Sync(); err != nil {
+		return err
+	}
+	q.unsynced = false
+	return nil
+}
+
+// evict removes the oldest segments past maxSize. A line peeked is sent
+// nonetheless.
+func (q *diskQueue) evict() {
+	for q.maxSize > 0 && len(q.segments) > 1 && q.end-q.segments[0] > q.maxSize {
+		off, following := q.segments[0], q.segments[1]
+		if q.next < following {
+			from := q.next
+			if q.head != nil {
+				from = q.headEnd
+			}
+			if from < following {
+				lines, _ := q.countLines(from, following)
+				q.count -= lines
+				q.lost += following - from
+			}
+			q.next = following
+			q.closeReader()
+		}
+		os.Remove(q.segment(off))
+		q.segments = q.segments[1:]
+	}
+}
+
+// discard removes the segments before offset off, whose lines have been
+// processed.
+func (q *diskQueue) discard(off int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.release(off)
+}
+
+// release is discard, with mu held.
+func (q *diskQueue) release(off int64) {
+	for len(q.segments) > 1 && q.segments[1] <= off && q.segments[1] <= q.next {
+		os.Remove(q.segment(q.segments[0]))
+		q.segments = q.segments[1:]
+	}
+}
+
+// takeLost returns the number of bytes evicted unread since the last call.
+func (q *diskQueue) takeLost() int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	lost := q.lost
+	q.lost = 0
+	return lost
+}
+
+// peek returns the oldest line in the queue, and the offset past it,
+// waiting for one if it is empty. It returns false if the queue is empty
+// and closed.
+func (q *diskQueue) peek() (*Line, int64, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.count == 0 {
+		return nil, 0, false
+	}
+	if q.head == nil {
+		b, err := q.read()
+		if err == nil {
+			q.head, err = decodeLine(b)
+		}
+		if err != nil {
+			// cannot happen short of disk failures: report it in place
+			q.head = &Line{Text: []byte(err.Error()), Err: err, Time: time.Now()}
+		}
+		q.headEnd = q.next + int64(len(b))
+	}
+	return q.head, q.headEnd, true
+}
+
+// read reads the line at next.
+func (q *diskQueue) read() ([]byte, error) {
+	off := q.segmentOf(q.next)
+	if q.rf != nil && q.rf.Name() != q.segment(off) {
+		q.closeReader()
+	}
+	if q.rf == nil {
+		f, err := os.Open(q.segment(off))
+		if err != nil {
+			return nil, err
+		}
+		q.rf = f
+		q.r = bufio.NewReader(&readerAt{r: f, off: q.next - off})
+	}
+	b, err := q.r.ReadBytes('\n')
+	if err != nil {
+		q.closeReader()
+		if err == io.EOF {
+			err = errors.New("tail: queue segment ends with a partial line")
+		}
+	}
+	return b, err
+}
+
+func (q *diskQueue) closeReader() {
+	if q.rf != nil {
+		q.rf.Close()
+		q.rf = nil
+		q.r = nil
+	}
+}
+
+// pop removes the line returned by peek from the queue.
+func (q *diskQueue) pop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.head == nil {
+		return
+	}
+	q.head = nil
+	if q.next < q.headEnd {
+		q.next = q.headEnd
+	}
+	q.count--
+	if !q.persistent {
+		q.release(q.next)
+	}
+	q.cond.Broadcast()
+}
+
+// wait waits for the queue to be empty.
+func (q *diskQueue) wait() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.count > 0 {
+		q.cond.Wait()
+	}
+}
+
+// close marks the end of the lines pushed.
+func (q *diskQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// shutdown closes the files of the queue, and removes them unless it is
+// persistent.
+func (q *diskQueue) shutdown() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closeReader()
+	if q.w != nil {
+		q.w.Close()
+		q.w = nil
+	}
+	if !q.persistent && len(q.segments) > 0 {
+		os.RemoveAll(q.dir)
+	}
+}
+
+type int64s []int64
+
+func (s int64s) Len() int           { return len(s) }
+func (s int64s) Less(i, j int) bool { return s[i] < s[j] }
+func (s int64s) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// readerAt reads r sequentially, with ReadAt, which does not share the
+// offset of writes.
+type readerAt struct {
+	r   io.ReaderAt
+	off int64
+}
+
+func (r *readerAt) Read(p []byte) (int, error) {
+	n, err := r.r.ReadAt(p, r.off)
+	r.off += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// encodedLine is a Line as stored on disk.
+type encodedLine struct {
+	Text      []byte
+	Err       string `json:",omitempty"`
+	Filename  string
+	FileID    FileID
+	Offset    int64
+	EndOffset int64
+	Num       uint64
+	Time      time.Time
+	Partial   bool                   `json:",omitempty"`
+	Part      int                    `json:",omitempty"`
+	Truncated bool                   `json:",omitempty"`
+	Fields    map[string]interface{} `json:",omitempty"`
+}
+
+// encodeLine encodes l as a line of JSON. Fields that cannot be encoded
+// are left out.
+func encodeLine(l *Line) ([]byte, error) {
+	e := encodedLine{
+		Text:      l.Text,
+		Filename:  l.Filename,
+		FileID:    l.FileID,
+		Offset:    l.Offset,
+		EndOffset: l.EndOffset,
+		Num:       l.Num,
+		Time:      l.Time,
+		Partial:   l.Partial,
+		Part:      l.Part,
+		Truncated: l.Truncated,
+		Fields:    l.Fields,
+	}
+	if l.Err != nil {
+		e.Err = l.Err.Error()
+	}
+	b, err := json.Marshal(e)
+	if err != nil && e.Fields != nil {
+		e.Fields = nil
+		b, err = json.Marshal(e)
+	}
+	return append(b, '\n'), err
+}
+
+func decodeLine(b []byte) (*Line, error) {
+	var e encodedLine
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	l := &Line{
+		Text:      e.Text,
+		Filename:  e.Filename,
+		FileID:    e.FileID,
+		Offset:    e.Offset,
+		EndOffset: e.EndOffset,
+		Num:       e.Num,
+		Time:      e.Time,
+		Partial:   e.Partial,
+		Part:      e.Part,
+		Truncated: e.Truncated,
+		Fields:    e.Fields,
+	}
+	if e.Err != "" {
+		l.Err = errors.New(e.Err)
+	}
+	if l.Text == nil {
+		l.Text = []byte{}
+	}
+	return l, nil
+}
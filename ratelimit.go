@@ -0,0 +1,133 @@
+package tail
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// rateLimiterMu serializes the use of rate limiters, which may be shared
+// by the tails of a MultiTail.
+var rateLimiterMu sync.Mutex
+
+// RateLimitPolicy selects what happens to lines read while
+// Config.RateLimiter is full.
+type RateLimitPolicy int
+
+const (
+	// RateLimitBlock stops reading until the bucket has drained.
+	RateLimitBlock RateLimitPolicy = iota
+	// RateLimitDrop drops lines while the bucket is full, and reports
+	// the number of dropped lines once lines are let through again.
+	RateLimitDrop
+	// RateLimitCoolOff reports the overflow, waits for the bucket to
+	// drain and then skips to the end of the file, discarding everything
+	// written in the meantime.
+	RateLimitCoolOff
+)
+
+// RateLimitError is the Err of the lines Tail sends to report that input
+// was discarded because of rate limiting.
+type RateLimitError struct {
+	Dropped int           // Lines dropped (RateLimitDrop)
+	CoolOff time.Duration // Time spent cooling off (RateLimitCoolOff)
+}
+
+func (e *RateLimitError) Error() string {
+	if e.Dropped > 0 {
+		return fmt.Sprintf("Too much log activity; %d lines dropped", e.Dropped)
+	}
+	return fmt.Sprintf("Too much log activity; waiting %s before resuming tailing", e.CoolOff)
+}
+
+// pour pours line into the rate limiter, blocking per RateLimitBlock.
+// It returns false if the line must not be sent, with stopped set if that
+// is because the tail was stopped while blocked.
+func (tail *Tail) pour(line []byte) (ok, stopped bool) {
+	if tail.RateLimiter == nil {
+		return true, false
+	}
+
+	amount := 1
+	if tail.RateLimitBytes {
+		amount = len(line)
+	}
+	// a single pour larger than the bucket can never succeed
+	if amount > int(tail.RateLimiter.Size) {
+		amount = int(tail.RateLimiter.Size)
+	}
+
+	for {
+		rateLimiterMu.Lock()
+		ok := tail.RateLimiter.Pour(uint16(amount))
+		wait := tail.RateLimiter.TimeToDrain()
+		rateLimiterMu.Unlock()
+
+		if ok {
+			return true, false
+		}
+		if tail.RateLimitPolicy != RateLimitBlock {
+			return false, false
+		}
+		if !tail.sleep(wait) {
+			return false, true
+		}
+	}
+}
+
+// sendDropped reports lines dropped by RateLimitDrop, if any.
+func (tail *Tail) sendDropped() {
+	if tail.dropped == 0 {
+		return
+	}
+	err := &RateLimitError{Dropped: tail.dropped}
+	tail.dropped = 0
+	tail.send(&Line{Text: []byte(err.Error()), Err: err, Filename: tail.Filename, Time: time.Now()})
+}
+
+// coolOff reports the overflow, waits for the rate limiter to drain and
+// discards everything written meanwhile.
+func (tail *Tail) coolOff() error {
+	rateLimiterMu.Lock()
+	err := &RateLimitError{CoolOff: tail.RateLimiter.TimeToDrain()}
+	rateLimiterMu.Unlock()
+
+	tail.log.Warn("Leaky bucket full; entering cooloff period", "file", tail.Filename, "cooloff", err.CoolOff)
+	tail.send(&Line{Text: []byte(err.Error()), Err: err, Filename: tail.Filename, Time: time.Now()})
+	if !tail.sleep(err.CoolOff) {
+		return nil
+	}
+	if err := tail.seekEnd(); err != nil {
+		return err
+	}
+	if !tail.Pipe {
+		end, err := tail.Tell()
+		if err != nil {
+			return err
+		}
+		tail.skipTo(end)
+	}
+	return nil
+}
+
+// skipTo marks the input before end as processed without sending it, so
+// that ExplicitCommit checkpoints are not held back by discarded lines.
+func (tail *Tail) skipTo(end int64) {
+	if tail.checkpoint != nil && tail.ExplicitCommit && !tail.Pipe {
+		tail.checkpoint.skip(tail.position(end))
+	}
+}
+
+// sleep waits for d. It returns false if the tail is stopped meanwhile.
+func (tail *Tail) sleep(d time.Duration) bool {
+	dying := tail.Dying()
+	if tail.Err() == errStopAtEOF {
+		dying = nil
+	}
+	select {
+	case <-time.After(d):
+		return true
+	case <-dying:
+		return false
+	}
+}
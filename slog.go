@@ -0,0 +1,15 @@
+//go:build go1.21
+// +build go1.21
+
+package tail
+
+import "log/slog"
+
+// NewSlogLogger returns a Logger logging to l, or to slog.Default() if l
+// is nil, for Config.Log. A *slog.Logger is a Logger as it is.
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return l
+}
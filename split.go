@@ -0,0 +1,86 @@
+package tail
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+)
+
+// readRecord reads the next record framed by Config.Split, or the next
+// part of a record that does not fit in the read buffer. At EOF, it
+// returns the rest of the input: the token Split returns for it, if any,
+// otherwise the input as is.
+func (tail *Tail) readRecord() (*Line, error) {
+	tail.lk.Lock()
+	defer tail.lk.Unlock()
+
+	size := tail.reader.Size()
+	for {
+		buf := tail.peekBuffered(size)
+		advance, token, err := tail.Split(buf, false)
+		if err != nil {
+			return &Line{}, err
+		}
+		if advance > 0 {
+			text := append([]byte(nil), token...)
+			tail.discard(advance)
+			if token == nil {
+				// input skipped by Split
+				continue
+			}
+			return &Line{Text: text}, nil
+		}
+		if len(buf) == size {
+			text := append([]byte(nil), buf...)
+			tail.discard(len(buf))
+			return &Line{Text: text, Partial: true}, nil
+		}
+
+		// more input is needed
+		if _, err := tail.reader.Peek(len(buf) + 1); err != nil {
+			buf = tail.peekBuffered(size)
+			text := buf
+			if _, token, splitErr := tail.Split(buf, true); splitErr == nil && token != nil {
+				text = token
+			}
+			text = append([]byte(nil), text...)
+			if len(text) > 0 {
+				// otherwise left to be read again
+				tail.discard(len(buf))
+			}
+			return &Line{Text: text}, err
+		}
+	}
+}
+
+// ScanLengthPrefixed returns a split function for Config.Split that frames
+// records prefixed by their length, as an unsigned integer of size bytes
+// (1, 2, 4 or 8) in the given byte order. The prefix is not part of the
+// records. MaxLineSize must fit the longest record, prefix included.
+func ScanLengthPrefixed(size int, order binary.ByteOrder) bufio.SplitFunc {
+	var length func(b []byte) uint64
+	switch size {
+	case 1:
+		length = func(b []byte) uint64 { return uint64(b[0]) }
+	case 2:
+		length = func(b []byte) uint64 { return uint64(order.Uint16(b)) }
+	case 4:
+		length = func(b []byte) uint64 { return uint64(order.Uint32(b)) }
+	case 8:
+		length = order.Uint64
+	default:
+		panic(fmt.Sprintf("tail: invalid length prefix size %d", size))
+	}
+
+	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+		if len(data) < size {
+			return 0, nil, nil
+		}
+		n := length(data[:size])
+		if n > uint64(len(data)-size) {
+			return 0, nil, nil
+		}
+		end := size + int(n)
+		return end, data[size:end], nil
+	}
+}
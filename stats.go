@@ -0,0 +1,102 @@
+package tail
+
+import (
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultMetricsInterval is used when Config.MetricsInterval is zero.
+var DefaultMetricsInterval = 10 * time.Second
+
+// Stats describes the reading of a tail.
+type Stats struct {
+	Filename  string
+	BytesRead int64  // Bytes of the lines read, delimiters included
+	LinesRead uint64 // Lines read, including those filtered out
+
+	Offset int64 // Position read up to in the current file
+	Size   int64 // Size of the file named Filename
+	Lag    int64 // Bytes left to read: Size - Offset, or Size once the file was replaced
+
+	Reopens        uint64 // Files reopened after being moved, deleted, truncated or retargeted
+	Truncations    uint64 // Truncations of the file
+	SymlinkChanges uint64 // Changes of the target of Filename, when a symlink
+	WatcherErrors  uint64 // Errors of the watcher of the file
+
+	LastLine time.Time     // When the last line was read; zero if none
+	Idle     time.Duration // Time since the last line was read, or since the tail started
+}
+
+// tailStats holds the counters of Stats, accessed atomically.
+type tailStats struct {
+	bytes          int64
+	lines          uint64
+	offset         int64
+	dev, ino       uint64 // identity of the file read
+	reopens        uint64
+	truncations    uint64
+	symlinkChanges uint64
+	watcherErrors  uint64
+	lastLine       int64 // in Unix nanoseconds
+	start          time.Time
+}
+
+// Stats returns the state of the reading of the file. It is safe to call
+// from any goroutine.
+func (tail *Tail) Stats() Stats {
+	s := &tail.stats
+	stats := Stats{
+		Filename:       tail.Filename,
+		BytesRead:      atomic.LoadInt64(&s.bytes),
+		LinesRead:      atomic.LoadUint64(&s.lines),
+		Offset:         atomic.LoadInt64(&s.offset),
+		Reopens:        atomic.LoadUint64(&s.reopens),
+		Truncations:    atomic.LoadUint64(&s.truncations),
+		SymlinkChanges: atomic.LoadUint64(&s.symlinkChanges),
+		WatcherErrors:  atomic.LoadUint64(&s.watcherErrors),
+	}
+	stats.Idle = time.Since(s.start)
+	if last := atomic.LoadInt64(&s.lastLine); last != 0 {
+		stats.LastLine = time.Unix(0, last)
+		stats.Idle = time.Since(stats.LastLine)
+	}
+	if !tail.Pipe {
+		if fi, err := os.Stat(tail.Filename); err == nil {
+			stats.Size = fi.Size()
+			stats.Lag = stats.Size
+			id := FileID{atomic.LoadUint64(&s.dev), atomic.LoadUint64(&s.ino)}
+			if fileIDOf(fi) == id {
+				stats.Lag -= stats.Offset
+			}
+			if stats.Lag < 0 {
+				stats.Lag = 0
+			}
+		}
+	}
+	return stats
+}
+
+// countLine counts a line read, of n bytes.
+func (tail *Tail) countLine(l *Line, n int64) {
+	atomic.AddInt64(&tail.stats.bytes, n)
+	atomic.AddUint64(&tail.stats.lines, 1)
+	atomic.StoreInt64(&tail.stats.lastLine, l.Time.UnixNano())
+}
+
+// reportStats passes the Stats of the tail to Config.Metrics periodically,
+// and once the tail is done.
+func (tail *Tail) reportStats() {
+	ticker := time.NewTicker(tail.MetricsInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			tail.Metrics(tail.Stats())
+		case <-tail.Dead():
+			tail.Metrics(tail.Stats())
+			return
+		}
+	}
+}
@@ -5,28 +5,96 @@ package tail
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"strconv"
+	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/pavamana1123/tail/ratelimiter"
-	"github.com/pavamana1123/tail/util"
 	"github.com/pavamana1123/tail/watch"
 	"gopkg.in/tomb.v1"
 )
 
 var (
 	ErrStop = fmt.Errorf("tail should now stop")
+
+	// ErrReOpenWithoutFollow is returned by TailFile when Config.ReOpen
+	// is set without Config.Follow.
+	ErrReOpenWithoutFollow = errors.New("tail: cannot set ReOpen without Follow")
 )
 
+// DefaultFingerprintSize is the number of bytes at the start of the file
+// compared to detect it being rewritten, when Config.FingerprintSize is 0.
+const DefaultFingerprintSize = 512
+
+// TruncationError is the Err of the line sent, with Config.TruncateMarker,
+// when the file is truncated and read again from its start.
+type TruncationError struct {
+	Filename string
+	Offset   int64 // Read position when the truncation was noticed
+	Lost     int64 // Bytes past Offset that were truncated before being read
+}
+
+func (e *TruncationError) Error() string {
+	return fmt.Sprintf("%s truncated at offset %d; %d bytes potentially lost", e.Filename, e.Offset, e.Lost)
+}
+
+// Line is a line read from the file, along with where and when it was
+// read. Offsets are not tracked for named pipes.
 type Line struct {
-	Text []byte
-	Err  error // Error from tail
+	Text      []byte
+	Err       error     // Error from tail
+	Filename  string    // Name of the file the line was read from
+	FileID    FileID    // Identity of the file the line was read from
+	Offset    int64     // Offset of the start of the line in the file
+	EndOffset int64     // Offset just past the line in the file, including its newline
+	Num       uint64    // Sequence number of the line, starting at 1
+	Time      time.Time // Time the line was read
+
+	// Lines longer than Config.MaxLineSize are sent in parts; Part is the
+	// index of this part, and Partial is set on all parts but the last.
+	Partial   bool
+	Part      int
+	Truncated bool // Line was cut at MaxLineSize (TruncateLongLines)
+
+	Fields map[string]interface{} // Fields parsed by Config.Parse
+
+	tail *Tail // tail that sent the line, which Commit is passed on to
+}
+
+// LongLinePolicy selects how lines longer than Config.MaxLineSize are sent.
+type LongLinePolicy int
+
+const (
+	// SplitLongLines sends long lines in parts of MaxLineSize bytes.
+	SplitLongLines LongLinePolicy = iota
+	// TruncateLongLines sends the first MaxLineSize bytes of long lines
+	// and discards the rest, up to the next newline.
+	TruncateLongLines
+	// ReassembleLongLines sends long lines whole, as long as they fit in
+	// MaxLineCap bytes; longer lines are split in parts of MaxLineCap
+	// bytes. MaxLineSize only sets the size of the read buffer.
+	ReassembleLongLines
+)
+
+// FileID identifies a file independently of its name, which tells apart
+// the files that successively appear under a name as it is rotated.
+// It is the zero value on platforms that do not expose inode numbers.
+type FileID struct {
+	Dev uint64 // Device number
+	Ino uint64 // Inode number
+}
+
+func (id FileID) known() bool {
+	return id.Dev != 0 || id.Ino != 0
 }
 
 // SeekInfo represents arguments to `os.Seek`
@@ -35,6 +103,24 @@ type SeekInfo struct {
 	Whence int // os.SEEK_*
 }
 
+// Logger is a leveled logger taking alternating keys and values after the
+// message, like log/slog, whose *slog.Logger is a Logger. It is the same
+// as watch.Logger.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// NewStdLogger returns a Logger printing to l, such as a *log.Logger, as
+// "LEVEL message key=value ...". Debug messages are dropped.
+func NewStdLogger(l interface {
+	Printf(format string, v ...interface{})
+}) Logger {
+	return watch.NewStdLogger(l)
+}
+
 type logger interface {
 	Fatal(v ...interface{})
 	Fatalf(format string, v ...interface{})
@@ -50,20 +136,110 @@ type logger interface {
 // Config is used to specify how a file must be tailed.
 type Config struct {
 	// File-specifc
-	Location    *SeekInfo // Seek to this location before tailing
-	ReOpen      bool      // Reopen recreated files (tail -F)
-	MustExist   bool      // Fail early if the file does not exist
-	Poll        bool      // Poll for file changes instead of using inotify
-	Pipe        bool      // Is a named pipe (mkfifo)
-	RateLimiter *ratelimiter.LeakyBucket
+	Location  *SeekInfo // Seek to this location before tailing; no further back than the start of the file
+	ReOpen    bool      // Reopen recreated files (tail -F)
+	MustExist bool      // Fail early if the file does not exist
+	Poll      bool      // Poll for file changes instead of using inotify
+	Pipe      bool      // Is a named pipe (mkfifo)
+
+	// LineLocation, if set, starts tailing at a line instead of Location:
+	// the last Lines lines, found scanning backward from the end, or line
+	// number Lines with FromStart (tail -n)
+	LineLocation *LineLocation
+
+	// TimeRange, if set, starts tailing at the first line logged at or
+	// after its Since time, binary searching the file, instead of at
+	// LineLocation or Location, and stops before the first line logged
+	// after its Until time
+	TimeRange *TimeRange
+
+	// RotateGrace is how long a file replaced by rotation keeps being read
+	// after its last write, for writers still holding it open
+	RotateGrace time.Duration
+
+	// FingerprintSize is the number of bytes at the start of the file
+	// compared on changes, which tells a file truncated and written again
+	// past the read position from one that grew
+	// (0: DefaultFingerprintSize, < 0: disabled)
+	FingerprintSize int
+	TruncateMarker  bool // Send a TruncationError line when the file is truncated
+
+	// Rate limiting
+	RateLimiter     *ratelimiter.LeakyBucket // Limit the rate of lines sent
+	RateLimitBytes  bool                     // Pour one unit per byte instead of one per line
+	RateLimitPolicy RateLimitPolicy          // What to do when RateLimiter is full
+
+	// Buffering of lines waiting for the consumer
+	BufferSize int            // Capacity of the Lines channel
+	Overflow   OverflowPolicy // What to do when the Lines channel is full
+	SpillDir   string         // Directory of the files of OverflowSpill (default: os.TempDir())
+
+	// Queue, if set, queues lines on disk for the consumer, across
+	// restarts; Overflow does not apply. Ignored by TailFileBatches.
+	Queue *Queue
 
 	// Generic IO
-	Follow      bool // Continue looking for new lines (tail -f)
-	MaxLineSize int  // If non-zero, split longer lines into multiple lines
+	Follow      bool           // Continue looking for new lines (tail -f)
+	MaxLineSize int            // If non-zero, split longer lines into multiple lines
+	LongLines   LongLinePolicy // How to send lines longer than MaxLineSize
+	MaxLineCap  int            // Longest line sent whole by ReassembleLongLines (0: no limit)
+	Delimiter   string         // Record terminator instead of "\n" or "\r\n", e.g. "\x00"
+
+	// Encoding, if set, is the encoding lines are decoded from to UTF-8:
+	// "utf-8", "utf-16" (little endian unless told otherwise by a byte
+	// order mark), "utf-16le", "utf-16be", "latin1", "shift_jis" (with Go
+	// 1.18 or later) or one registered with RegisterEncoding. Byte order
+	// marks take precedence, and are skipped.
+	Encoding    string
+	InvalidUTF8 InvalidUTF8Policy // What to do with lines that are not valid UTF-8
+
+	// PartialLineTimeout, if set, is how long the last line of a followed
+	// file is waited for to be completed by a delimiter. It is then sent
+	// as it is, flagged Partial.
+	PartialLineTimeout   time.Duration
+	ContinuePartialLines bool // Send the rest of such lines as their next parts, not as new lines
+
+	Multiline *Multiline // Group lines into events, such as stack traces
+
+	// Split, if set, frames records instead of Delimiter, like for a
+	// bufio.Scanner. Records longer than MaxLineSize, or than
+	// bufio.MaxScanTokenSize if unset, are sent in parts; LongLines does
+	// not apply.
+	Split bufio.SplitFunc
+
+	// Parse, if set, parses lines into their Fields, e.g. ParseJSON,
+	// ParseLogfmt, ParseSyslog, ParseCombinedLog or ParseRegexp. Lines
+	// that fail to parse are sent with a ParseError.
+	Parse ParseFunc
+
+	// Processors filter and transform lines, in turn, before they are
+	// rate limited and sent, e.g. Include, Exclude, FieldMatches, Sample,
+	// Redact or RedactSecrets
+	Processors []Processor
+
+	// Position checkpointing
+	PosFile         string        // Save the read position to this file and resume from it
+	PosFileInterval time.Duration // How often to save the position (default: DefaultPosFileInterval)
+	ExplicitCommit  bool          // Save only positions acknowledged through Tail.Commit
+
+	// Events, if set, is passed the lifecycle events of the tail, such as
+	// rotations, from the goroutine of the tail
+	Events func(Event)
+
+	// Metrics, if set, is passed the Stats of the tail every
+	// MetricsInterval (default: DefaultMetricsInterval), and once it is done
+	Metrics         func(Stats)
+	MetricsInterval time.Duration
+
+	// Log is what the tail, and its watcher, log to. It takes precedence
+	// over Logger, which is only used, through NewStdLogger, when Log is
+	// nil.
+	Log Logger
 
-	PosFile string
 	// Logger, when nil, is set to tail.DefaultLogger
 	// To disable logging: set field to tail.DiscardingLogger
+	//
+	// Deprecated: use Log.
 	Logger logger
 }
 
@@ -75,8 +251,37 @@ type Tail struct {
 	File   *os.File
 	reader *bufio.Reader
 
+	decompressed *decompressedFile // content of File if compressed (no Follow)
+
 	watcher watch.FileWatcher
 	changes *watch.FileChanges
+	log     Logger
+
+	id         FileID        // identity of File
+	num        uint64        // number of lines read
+	dropped    int           // lines dropped since the last RateLimitError
+	part       int           // index of the next part of a long line
+	resume     *position     // position loaded from PosFile
+	checkpoint *checkpoint   // nil unless PosFile is set
+	multiline  *multiline    // nil unless Multiline is set
+	encoding   *encoding     // encoding of File, nil if not decoded
+	delim, cr  []byte        // delimiter and carriage return, encoded by openReader
+	consumed   int64         // bytes of input consumed through reader
+	batcher    *batcher      // nil unless created by TailFileBatches
+	disk       *diskQueue    // nil unless Queue is set, or Overflow is OverflowSpill
+	cursor     *checkpoint   // position in Queue, nil unless Queue is set
+	forwarded  chan struct{} // closed once lines are no longer sent from disk
+	queue      queueStats
+	stats      tailStats
+
+	unsent   bool  // a line was read but not sent, as the tail stopped
+	unsentAt int64 // its offset, which the position saved does not pass
+
+	atEOF        bool      // ReachedEOF was sent, and no line read since
+	partialEnd   int64     // end of the last line, read without delimiter
+	partialSince time.Time // when that line last grew; zero if none
+
+	untilReached bool // a line logged after TimeRange.Until was read
 
 	tomb.Tomb // provides: Done, Kill, Dying
 
@@ -95,25 +300,78 @@ var (
 // invoke the `Wait` or `Err` method after finishing reading from the
 // `Lines` channel.
 func TailFile(filename string, config Config) (*Tail, error) {
+	return tailFile(filename, config, nil)
+}
+
+func tailFile(filename string, config Config, batcher *batcher) (*Tail, error) {
 	if config.ReOpen && !config.Follow {
-		util.Fatal("cannot set ReOpen without Follow.")
+		return nil, ErrReOpenWithoutFollow
+	}
+	if m := config.Multiline; m != nil && m.Start == nil && m.Continue == nil && !m.Indented {
+		return nil, ErrInvalidMultiline
+	}
+	if _, err := lookupEncoding(config.Encoding); err != nil {
+		return nil, err
+	}
+	if config.LineLocation != nil && config.Split != nil {
+		return nil, ErrLineLocationWithSplit
+	}
+	if config.TimeRange != nil && !config.TimeRange.Since.IsZero() && config.Split != nil {
+		return nil, ErrTimeRangeWithSplit
 	}
 
 	t := &Tail{
 		Filename: filename,
-		Lines:    make(chan *Line),
+		Lines:    make(chan *Line, config.BufferSize),
 		Config:   config,
+		batcher:  batcher,
+		stats:    tailStats{start: time.Now()},
+	}
+	if t.Multiline != nil {
+		t.multiline = &multiline{Multiline: t.Multiline}
 	}
 
 	// when Logger was not specified in config, use default logger
 	if t.Logger == nil {
 		t.Logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
+	t.log = t.Log
+	if t.log == nil {
+		t.log = NewStdLogger(t.Logger)
+	}
 
+	if t.FingerprintSize == 0 {
+		t.FingerprintSize = DefaultFingerprintSize
+	}
+	fingerprintSize := t.FingerprintSize
+	if fingerprintSize < 0 {
+		fingerprintSize = 0
+	}
 	if t.Poll {
-		t.watcher = watch.NewPollingFileWatcher(filename)
+		w := watch.NewPollingFileWatcher(filename)
+		w.FingerprintSize = fingerprintSize
+		w.Logger = t.log
+		t.watcher = w
 	} else {
-		t.watcher = watch.NewInotifyFileWatcher(filename)
+		w := watch.NewInotifyFileWatcher(filename)
+		w.FingerprintSize = fingerprintSize
+		w.Logger = t.log
+		t.watcher = w
+	}
+
+	if t.PosFile != "" {
+		var err error
+		t.resume, err = readPosFile(t.PosFile)
+		if err != nil {
+			return nil, err
+		}
+		t.checkpoint = &checkpoint{filename: t.PosFile}
+		if t.resume != nil {
+			t.checkpoint.pos = *t.resume
+		}
+		if t.PosFileInterval <= 0 {
+			t.PosFileInterval = DefaultPosFileInterval
+		}
 	}
 
 	if t.MustExist {
@@ -122,9 +380,64 @@ func TailFile(filename string, config Config) (*Tail, error) {
 		if err != nil {
 			return nil, err
 		}
+		t.identify()
 	}
 
+	if t.Queue != nil && t.batcher == nil {
+		t.cursor = &checkpoint{filename: filepath.Join(t.Queue.Dir, "cursor")}
+		pos, err := readPosFile(t.cursor.filename)
+		if err != nil {
+			return nil, err
+		}
+		if pos != nil {
+			t.cursor.pos = *pos
+		}
+		if t.disk, t.num, err = openQueue(t.Queue, t.cursor.pos.Offset); err != nil {
+			return nil, err
+		}
+		if t.checkpoint != nil {
+			// the position in the file passes lines once queued
+			t.checkpoint.sync = t.disk.sync
+		}
+		if t.PosFileInterval <= 0 {
+			t.PosFileInterval = DefaultPosFileInterval
+		}
+	} else if t.Overflow == OverflowSpill && t.batcher == nil {
+		t.disk = newDiskQueue(t.SpillDir, 0, 0)
+	}
+	if t.disk != nil {
+		t.forwarded = make(chan struct{})
+		go t.forward()
+	}
 	go t.tailFileSync()
+	if t.checkpoint != nil || t.cursor != nil {
+		go t.saveTailPositions()
+	}
+	if t.Metrics != nil {
+		if t.MetricsInterval <= 0 {
+			t.MetricsInterval = DefaultMetricsInterval
+		}
+		go t.reportStats()
+	}
+
+	return t, nil
+}
+
+// TailFileContext is like TailFile, but stops tailing when ctx is done,
+// in which case `Wait` and `Err` return ctx.Err().
+func TailFileContext(ctx context.Context, filename string, config Config) (*Tail, error) {
+	t, err := TailFile(filename, config)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			t.Kill(ctx.Err())
+		case <-t.Dying():
+		}
+	}()
 
 	return t, nil
 }
@@ -133,11 +446,13 @@ func TailFile(filename string, config Config) (*Tail, error) {
 // But this value is not very accurate.
 // it may readed one line in the chan(tail.Lines),
 // so it may lost one line.
+// Use Config.ExplicitCommit and Commit for exact checkpoints.
+// Offsets of compressed files are in their decompressed content.
 func (tail *Tail) Tell() (offset int64, err error) {
 	if tail.File == nil {
 		return
 	}
-	offset, err = tail.File.Seek(0, os.SEEK_CUR)
+	offset, err = tail.input().Seek(0, os.SEEK_CUR)
 	if err != nil {
 		return
 	}
@@ -152,6 +467,33 @@ func (tail *Tail) Tell() (offset int64, err error) {
 	return
 }
 
+// Commit acknowledges that line has been processed. With ExplicitCommit
+// set, the position saved to PosFile only advances past a line once it
+// and every line sent before it have been committed, so lines that were
+// read but not processed before a crash are read again on restart.
+// With Queue set, it is the position in the queue that advances instead.
+// Lines must not be committed more than once.
+func (tail *Tail) Commit(line *Line) error {
+	if !tail.ExplicitCommit {
+		return nil
+	}
+	if line.tail != tail {
+		// Num is only unique among the lines of a tail
+		return ErrNotPending
+	}
+	if tail.cursor != nil {
+		if err := tail.cursor.commit(line); err != nil {
+			return err
+		}
+		tail.disk.discard(tail.cursor.offset())
+		return nil
+	}
+	if tail.checkpoint == nil {
+		return nil
+	}
+	return tail.checkpoint.commit(line)
+}
+
 // Stop stops the tailing activity.
 func (tail *Tail) Stop() error {
 	tail.Kill(nil)
@@ -168,31 +510,166 @@ var errStopAtEOF = errors.New("tail: stop at eof")
 
 func (tail *Tail) close() {
 
+	tail.flushBatch()
 	tail.updateTailPosition()
+	tail.event(Event{Type: Stopped, Offset: tail.readOffset()})
 	tail.closeFile()
+	if tail.cursor != nil {
+		// lines left in the queue are sent by the next tail
+		tail.disk.close()
+		<-tail.forwarded
+		if err := tail.cursor.flush(); err != nil {
+			tail.log.Error("Failed to update position file", "file", tail.cursor.filename, "err", err)
+		}
+		tail.disk.shutdown()
+	}
 	tail.Done()
-	close(tail.Lines)
+	if tail.disk != nil && tail.cursor == nil {
+		// closed once spilled lines are sent
+		tail.disk.close()
+	} else {
+		close(tail.Lines)
+	}
 }
 
 func (tail *Tail) updateTailPosition() {
-	if tail.Config.PosFile != "" {
+	if tail.checkpoint == nil {
+		return
+	}
 
+	if tail.File != nil && !tail.Pipe && !tail.ExplicitCommit {
 		newPos, err := tail.Tell()
 		if err != nil {
-			log.Println("TailReader: Unable to get position, not updating. ", err)
+			tail.log.Error("Unable to get position, not updating", "file", tail.Filename, "err", err)
 			return
 		}
+		if tail.unsent && tail.unsentAt < newPos {
+			newPos = tail.unsentAt
+		}
+		tail.checkpoint.set(tail.position(tail.sentUpTo(newPos)))
+	}
 
-		err = ioutil.WriteFile(tail.Config.PosFile, []byte(strconv.FormatInt(newPos, 10)), 0644)
-		if err != nil {
-			log.Println("Failed to update position", newPos, err)
+	if err := tail.checkpoint.flush(); err != nil {
+		tail.log.Error("Failed to update position file", "file", tail.PosFile, "err", err)
+	}
+}
+
+// saveTailPositions periodically flushes the checkpoint to PosFile, and the
+// position in Queue, until the tail is stopped; the final positions are
+// saved by close.
+func (tail *Tail) saveTailPositions() {
+	ticker := time.NewTicker(tail.PosFileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, c := range []*checkpoint{tail.checkpoint, tail.cursor} {
+				if c == nil {
+					continue
+				}
+				if err := c.flush(); err != nil {
+					tail.log.Error("Failed to update position file", "file", c.filename, "err", err)
+				}
+			}
+		case <-tail.Dying():
 			return
 		}
+	}
+}
 
+// identify records the identity of the currently open file, for the
+// watcher to report changes from it.
+func (tail *Tail) identify() {
+	fi, err := tail.File.Stat()
+	if err == nil {
+		tail.id = fileIDOf(fi)
+		atomic.StoreUint64(&tail.stats.dev, tail.id.Dev)
+		atomic.StoreUint64(&tail.stats.ino, tail.id.Ino)
+	} else {
+		fi = nil
+	}
+	switch w := tail.watcher.(type) {
+	case *watch.InotifyFileWatcher:
+		w.Opened = fi
+	case *watch.PollingFileWatcher:
+		w.Opened = fi
 	}
 }
 
+// startLocation returns where to seek on the first open of the file:
+// the position saved in PosFile if it still applies to this file,
+// otherwise Config.TimeRange, Config.LineLocation or Config.Location.
+func (tail *Tail) startLocation() (*SeekInfo, error) {
+	if tail.resume == nil || tail.Pipe {
+		return tail.configLocation()
+	}
+	fi, err := tail.File.Stat()
+	if err != nil {
+		return tail.configLocation()
+	}
+	valid := tail.resume.validFor(fi)
+	if tail.decompressed != nil {
+		// offsets are in the decompressed content, of any size
+		fr := tail.resume.Frame
+		valid = tail.resume.sameFile(fi) && fr.Compressed <= fi.Size() &&
+			fr.Decompressed <= tail.resume.Offset
+	}
+	if !valid {
+		tail.log.Warn("Ignoring saved position: file was rotated or truncated",
+			"file", tail.Filename, "offset", tail.resume.Offset)
+		return tail.configLocation()
+	}
+	if tail.decompressed != nil {
+		// decompressed from the frame holding the offset, not from the start
+		if err := tail.decompressed.open(tail.resume.Frame); err != nil {
+			tail.log.Warn("Ignoring saved position: no frame where it was saved",
+				"file", tail.Filename, "offset", tail.resume.Offset, "err", err)
+			if err := tail.decompressed.open(frame{}); err != nil {
+				return nil, err
+			}
+			return tail.configLocation()
+		}
+	}
+	return &SeekInfo{Offset: tail.resume.Offset, Whence: os.SEEK_SET}, nil
+}
+
+// position returns the position of offset in the file, with the frame
+// holding it if the file is compressed.
+func (tail *Tail) position(offset int64) position {
+	pos := position{Offset: offset, ID: tail.id}
+	if tail.decompressed != nil {
+		pos.Frame = tail.decompressed.frameAt(offset)
+	}
+	return pos
+}
+
+// configLocation returns where Config.TimeRange, Config.LineLocation or
+// Config.Location start reading.
+func (tail *Tail) configLocation() (*SeekInfo, error) {
+	var offset int64
+	var err error
+	switch {
+	case tail.Pipe:
+		return tail.Location, nil
+	case tail.TimeRange != nil && !tail.TimeRange.Since.IsZero():
+		offset, err = tail.sinceOffset()
+	case tail.LineLocation != nil:
+		offset, err = tail.lineOffset(tail.LineLocation)
+	default:
+		return tail.Location, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SeekInfo{Offset: offset, Whence: os.SEEK_SET}, nil
+}
+
 func (tail *Tail) closeFile() {
+	if tail.decompressed != nil {
+		tail.decompressed.Close()
+		tail.decompressed = nil
+	}
 	if tail.File != nil {
 		tail.File.Close()
 		tail.File = nil
@@ -200,18 +677,23 @@ func (tail *Tail) closeFile() {
 }
 
 func (tail *Tail) reopen() error {
+	// multiline events do not span files
+	tail.sendEvent()
 	tail.closeFile()
 	for {
 		var err error
 		tail.File, err = OpenFile(tail.Filename)
 		if err != nil {
 			if os.IsNotExist(err) {
-				// log.Println("Waiting for to appear...", tail.Filename)
-				tail.Logger.Printf("Waiting for %s to appear...", tail.Filename)
+				tail.log.Info("Waiting for file to appear", "file", tail.Filename)
+				tail.event(Event{Type: WaitingForFile})
 				if err := tail.watcher.BlockUntilExists(&tail.Tomb); err != nil {
 					if err == tomb.ErrDying {
 						return err
 					}
+					if _, ok := err.(*watch.Error); ok {
+						return err
+					}
 					return fmt.Errorf("Failed to detect creation of %s: %s", tail.Filename, err)
 				}
 				continue
@@ -220,19 +702,190 @@ func (tail *Tail) reopen() error {
 		}
 		break
 	}
+	tail.identify()
+	tail.atEOF = false
+	tail.event(Event{Type: FileOpened})
 	return nil
 }
 
-func (tail *Tail) readLine() ([]byte, error) {
+// readLine reads the next line, or the next part of a line longer than
+// the line size limit. The delimiter is consumed but not returned. On
+// error, it returns whatever was read of the current line.
+func (tail *Tail) readLine() (*Line, error) {
+	if tail.Split != nil {
+		return tail.readRecord()
+	}
+
+	tail.lk.Lock()
+	defer tail.lk.Unlock()
 
-	var lineBytes []byte
+	delim, cr := tail.delim, tail.cr
+	unit := tail.unit()
+	limit := tail.lineLimit()
+	var text []byte
+	for {
+		n := tail.reader.Size()
+		if limit > 0 && limit-len(text)+len(delim)+len(cr) < n {
+			// peek past the limit to see a delimiter following it
+			n = limit - len(text) + len(delim) + len(cr)
+		}
+		// look at buffered data first; filling the buffer moves it
+		var err error
+		buf := tail.peekBuffered(n)
+		if indexDelim(buf, delim, len(text), unit) < 0 && len(buf) < n {
+			buf, err = tail.fill(n)
+		}
+
+		if i := indexDelim(buf, delim, len(text), unit); i >= 0 {
+			length := len(text) + i
+			if cr != nil && endsWith(text, buf[:i], cr) {
+				length -= len(cr)
+			}
+			if limit == 0 || length <= limit {
+				text = append(text, buf[:i]...)
+				tail.discard(i + len(delim))
+				return &Line{Text: text[:length]}, nil
+			}
+		}
+
+		if limit > 0 && len(text)+len(buf) > limit && (len(buf) == n || err != nil) {
+			room := limit - len(text)
+			text = append(text, buf[:room]...)
+			tail.discard(room)
+			if tail.LongLines == TruncateLongLines {
+				return tail.discardLine(text)
+			}
+			return &Line{Text: text, Partial: true}, nil
+		}
+
+		// keep what may be the start of a delimiter for the next peek
+		take := len(buf) - delimPrefix(buf, delim, err)
+		if limit > 0 && len(text)+take > limit {
+			// whether the line is over the limit is known with more data
+			take = limit - len(text)
+		}
+		text = append(text, buf[:take]...)
+		tail.discard(take)
+		if err != nil {
+			return &Line{Text: text}, err
+		}
+	}
+}
+
+// delimiter returns the record delimiter, and the carriage return dropped
+// before it if any, in the encoding of the file. readLine uses them as
+// encoded by openReader.
+func (tail *Tail) delimiter() (delim, cr []byte) {
+	if tail.Delimiter == "" {
+		return tail.encoding.encode("\n"), tail.encoding.encode("\r")
+	}
+	return tail.encoding.encode(tail.Delimiter), nil
+}
+
+// unit returns the size of the code units of the encoding of the file;
+// delimiters are only looked for at code unit boundaries.
+func (tail *Tail) unit() int {
+	if tail.encoding == nil {
+		return 1
+	}
+	return tail.encoding.unit
+}
+
+// indexDelim returns the index of the first delimiter in buf at a code
+// unit boundary, given that buf follows n bytes of the line, or -1.
+func indexDelim(buf, delim []byte, n, unit int) int {
+	for off := 0; ; {
+		i := bytes.Index(buf[off:], delim)
+		if i < 0 {
+			return -1
+		}
+		if (n+off+i)%unit == 0 {
+			return off + i
+		}
+		off += i + 1
+	}
+}
+
+// endsWith reports whether a followed by b ends with suffix.
+func endsWith(a, b, suffix []byte) bool {
+	if len(b) >= len(suffix) {
+		return bytes.HasSuffix(b, suffix)
+	}
+	k := len(suffix) - len(b)
+	return bytes.HasSuffix(a, suffix[:k]) && bytes.Equal(b, suffix[k:])
+}
+
+// discard consumes n bytes of the reader, counted for the offsets of the
+// lines read.
+func (tail *Tail) discard(n int) {
+	n, _ = tail.reader.Discard(n)
+	tail.consumed += int64(n)
+}
+
+// peekBuffered returns up to n bytes without reading from the file.
+func (tail *Tail) peekBuffered(n int) []byte {
+	if buffered := tail.reader.Buffered(); buffered < n {
+		n = buffered
+	}
+	buf, _ := tail.reader.Peek(n)
+	return buf
+}
+
+// fill reads from the file once, unless n bytes are buffered already, and
+// returns up to n buffered bytes. It never waits for more than a read
+// returns, so that a line written to a pipe is seen as soon as it arrives.
+func (tail *Tail) fill(n int) ([]byte, error) {
 	var err error
+	if buffered := tail.reader.Buffered(); buffered < n {
+		_, err = tail.reader.Peek(buffered + 1)
+	}
+	return tail.peekBuffered(n), err
+}
 
-	tail.lk.Lock()
-	lineBytes, _, err = tail.reader.ReadLine()
-	tail.lk.Unlock()
+// delimPrefix returns the number of bytes at the end of buf, read with
+// error err, that may be the start of a delimiter.
+func delimPrefix(buf, delim []byte, err error) int {
+	if err != nil || len(delim) < 2 {
+		return 0
+	}
+	if len(delim)-1 > len(buf) {
+		return len(buf)
+	}
+	return len(delim) - 1
+}
 
-	return lineBytes, err
+// discardLine skips the rest of a line cut at MaxLineSize.
+func (tail *Tail) discardLine(text []byte) (*Line, error) {
+	delim := tail.delim
+	unit := tail.unit()
+	n := len(text)
+	for {
+		var err error
+		buf := tail.peekBuffered(tail.reader.Size())
+		if indexDelim(buf, delim, n, unit) < 0 {
+			buf, err = tail.fill(tail.reader.Size())
+		}
+		if i := indexDelim(buf, delim, n, unit); i >= 0 {
+			tail.discard(i + len(delim))
+			return &Line{Text: text, Truncated: true}, nil
+		}
+		take := len(buf) - delimPrefix(buf, delim, err)
+		n += take
+		tail.discard(take)
+		if err != nil {
+			return &Line{Text: text, Truncated: true}, err
+		}
+	}
+}
+
+// lineLimit returns the maximum length of the lines sent, or 0, in whole
+// code units.
+func (tail *Tail) lineLimit() int {
+	limit := tail.MaxLineSize
+	if tail.LongLines == ReassembleLongLines {
+		limit = tail.MaxLineCap
+	}
+	return limit - limit%tail.unit()
 }
 
 func (tail *Tail) tailFileSync() {
@@ -247,12 +900,33 @@ func (tail *Tail) tailFileSync() {
 			}
 			return
 		}
+	} else {
+		tail.event(Event{Type: FileOpened})
+	}
+
+	// Compressed files are read decompressed, unless followed.
+	if !tail.Follow && !tail.Pipe {
+		if err := tail.decompress(); err != nil {
+			tail.Killf("Unable to read %s: %s", tail.Filename, err)
+			return
+		}
 	}
 
 	// Seek to requested location on first open of the file.
-	if tail.Location != nil {
-		_, err := tail.File.Seek(tail.Location.Offset, tail.Location.Whence)
-		// tail.Logger.Printf("Seeked %s - %+v\n", tail.Filename, tail.Location)
+	location, err := tail.startLocation()
+	if err != nil {
+		tail.Killf("Unable to find the start of %s: %s", tail.Filename, err)
+		return
+	}
+	if location != nil {
+		if location.Whence == os.SEEK_END && location.Offset < 0 {
+			// as tail -c, read the whole of a file shorter than asked
+			if size, err := tail.input().Seek(0, os.SEEK_END); err == nil && size < -location.Offset {
+				location = &SeekInfo{Offset: 0, Whence: os.SEEK_SET}
+			}
+		}
+		_, err := tail.input().Seek(location.Offset, location.Whence)
+		// tail.Logger.Printf("Seeked %s - %+v\n", tail.Filename, location)
 		if err != nil {
 			tail.Killf("Seek error on %s: %s", tail.Filename, err)
 			return
@@ -261,11 +935,30 @@ func (tail *Tail) tailFileSync() {
 
 	tail.openReader()
 
-	var (
-		offset int64
-		err    error
-		line   []byte
-	)
+	for {
+		err := tail.readLines(!tail.Follow)
+		if err == nil && tail.Follow {
+			// When EOF is reached, wait for more data to become
+			// available. Wait strategy is based on the `tail.watcher`
+			// implementation (inotify or polling).
+			err = tail.waitForChanges()
+		}
+		if err != nil && err != ErrStop {
+			tail.Kill(err)
+		}
+		if err != nil || !tail.Follow {
+			return
+		}
+	}
+}
+
+// readLines sends the lines of the file up to EOF. A last line without
+// newline is sent if final is set, and is otherwise left to be read
+// again once complete.
+func (tail *Tail) readLines(final bool) error {
+	// offset of the next line, counted from the position of the file as
+	// lines are consumed; -1 when it has to be asked for
+	offset := int64(-1)
 
 	// Read line by line.
 	for {
@@ -273,51 +966,68 @@ func (tail *Tail) tailFileSync() {
 		// do not seek in named pipes
 		if !tail.Pipe {
 			// grab the position in case we need to back up in the event of a half-line
-			offset, err = tail.Tell()
-			if err != nil {
-				log.Println("Tell:", err)
-				tail.Kill(err)
-				return
+			if offset < 0 {
+				var err error
+				offset, err = tail.Tell()
+				if err != nil {
+					tail.log.Error("Unable to get position", "file", tail.Filename, "err", err)
+					return err
+				}
+			}
+			atomic.StoreInt64(&tail.stats.offset, offset)
+			// everything before offset has been sent, but for a
+			// pending multiline event
+			if tail.checkpoint != nil && !tail.ExplicitCommit {
+				tail.checkpoint.set(tail.position(tail.sentUpTo(offset)))
 			}
 		}
 
-		line, err = tail.readLine()
+		consumed := tail.consumed
+		line, err := tail.readLine()
+		end := offset + tail.consumed - consumed
 
 		// Process `line` even if err is EOF.
-		if err == nil || err == bufio.ErrBufferFull {
-			tail.sendLine(line)
-		} else if err == io.EOF {
-			if !tail.Follow {
-				if len(line) != 0 {
-					tail.sendLine(line)
+		if err == nil {
+			tail.partialSince = time.Time{}
+			tail.atEOF = false
+			ok := tail.sendLine(line, offset, end)
+			offset = end
+			if !ok && tail.RateLimitPolicy == RateLimitCoolOff {
+				if err := tail.coolOff(); err != nil {
+					return err
 				}
-				return
+				// moved to the end of the file
+				offset = -1
 			}
-
-			if tail.Follow && len(line) != 0 {
-				// this has the potential to never return the last line if
-				// it's not followed by a newline; seems a fair trade here
-				err := tail.seekTo(SeekInfo{Offset: offset, Whence: 0})
-				if err != nil {
-					tail.Kill(err)
-					return
+		} else if err == io.EOF {
+			if len(line.Text) != 0 || line.Truncated {
+				if final {
+					tail.sendLine(line, offset, end)
+				} else if tail.partialIdle() {
+					tail.sendPartial(line, offset, end)
+				} else {
+					// this has the potential to never return the last line if
+					// it's not followed by a newline, unless PartialLineTimeout
+					// is set; seems a fair trade here
+					err := tail.seekTo(SeekInfo{Offset: offset, Whence: 0})
+					if err != nil {
+						return err
+					}
 				}
 			}
-
-			// When EOF is reached, wait for more data to become
-			// available. Wait strategy is based on the `tail.watcher`
-			// implementation (inotify or polling).
-			err := tail.waitForChanges()
-			if err != nil {
-				if err != ErrStop {
-					tail.Kill(err)
-				}
-				return
+			if final || tail.Err() == errStopAtEOF {
+				tail.sendEvent()
 			}
+			if !tail.atEOF {
+				tail.atEOF = true
+				tail.event(Event{Type: ReachedEOF, Offset: offset})
+			}
+			tail.sendDropped()
+			tail.idleBatch(final || tail.Err() == errStopAtEOF)
+			return nil
 		} else {
 			// non-EOF error
-			tail.Killf("Error reading %s: %s", tail.Filename, err)
-			return
+			return fmt.Errorf("Error reading %s: %s", tail.Filename, err)
 		}
 
 		select {
@@ -325,12 +1035,42 @@ func (tail *Tail) tailFileSync() {
 			if tail.Err() == errStopAtEOF {
 				continue
 			}
-			return
+			return ErrStop
 		default:
 		}
 	}
 }
 
+// drain sends the rest of the file being replaced after a rotation. Writes
+// to the file are waited for until none happened for Config.RotateGrace.
+func (tail *Tail) drain() error {
+	for {
+		if err := tail.readLines(false); err != nil {
+			return err
+		}
+		if tail.RotateGrace <= 0 || tail.Pipe {
+			break
+		}
+		size := tail.fileSize()
+		if !tail.sleep(tail.RotateGrace) {
+			return ErrStop
+		}
+		if tail.fileSize() <= size {
+			break
+		}
+	}
+	// no more writes expected: the last line is complete
+	return tail.readLines(true)
+}
+
+func (tail *Tail) fileSize() int64 {
+	fi, err := tail.File.Stat()
+	if err != nil {
+		return 0
+	}
+	return fi.Size()
+}
+
 // waitForChanges waits until the file has been appended, deleted,
 // moved or truncated. When moved or deleted - the file will be
 // reopened if ReOpen is true. Truncated files are always reopened.
@@ -339,12 +1079,13 @@ func (tail *Tail) waitForChanges() error {
 	if tail.changes == nil {
 		pos, err := tail.File.Seek(0, os.SEEK_CUR)
 		if err != nil {
-			log.Println("tail.File.Seek:", err)
+			tail.log.Error("Unable to get position", "file", tail.Filename, "err", err)
 			return err
 		}
 		tail.changes, err = tail.watcher.ChangeEvents(&tail.Tomb, pos)
 		if err != nil {
-			log.Println("tail.watcher.ChangeEvents:", err)
+			atomic.AddUint64(&tail.stats.watcherErrors, 1)
+			tail.log.Error("Unable to watch file", "file", tail.Filename, "err", err)
 			return err
 		}
 	}
@@ -353,40 +1094,69 @@ func (tail *Tail) waitForChanges() error {
 	case <-tail.changes.Modified:
 		return nil
 	case <-tail.changes.Deleted:
+		tail.changes = nil
+		if err := tail.drain(); err != nil {
+			return err
+		}
+		tail.event(Event{Type: FileRotated, Offset: tail.readOffset()})
 		if tail.ReOpen {
-			tail.changes = nil
-			// XXX: we must not log from a library.
-			tail.Logger.Printf("Re-opening moved/deleted file %s ...", tail.Filename)
+			tail.log.Info("Re-opening moved or deleted file", "file", tail.Filename)
 			if err := tail.reopen(); err != nil {
-				log.Println("tail.ReOpen:", err)
+				tail.log.Error("Unable to reopen file", "file", tail.Filename, "err", err)
 				return err
 			}
-			tail.Logger.Printf("Successfully reopened %s", tail.Filename)
+			tail.log.Info("Successfully reopened file", "file", tail.Filename)
+			atomic.AddUint64(&tail.stats.reopens, 1)
 			tail.openReader()
 			return nil
 		} else {
-			tail.Logger.Printf("Stopping tail as file no longer exists: %s", tail.Filename)
+			tail.log.Info("Stopping tail as file no longer exists", "file", tail.Filename)
 			return ErrStop
 		}
 	case <-tail.changes.SymLinkChanged:
-
+		atomic.AddUint64(&tail.stats.symlinkChanges, 1)
 		tail.changes = nil
+		if err := tail.drain(); err != nil {
+			return err
+		}
+		tail.event(Event{Type: SymlinkRetargeted, Offset: tail.readOffset()})
 		// Always reopen files if symlink target is changed (Follow is true)
-		tail.Logger.Printf("Re-opening new symlink target file %s ...", tail.Filename)
+		tail.log.Info("Re-opening new symlink target file", "file", tail.Filename)
 		if err := tail.reopen(); err != nil {
 			return err
 		}
-		tail.Logger.Printf("Successfully opened %s", tail.Filename)
+		tail.log.Info("Successfully opened file", "file", tail.Filename)
+		atomic.AddUint64(&tail.stats.reopens, 1)
 		tail.openReader()
 		return nil
+	case err := <-tail.changes.Error:
+		atomic.AddUint64(&tail.stats.watcherErrors, 1)
+		tail.changes = nil
+		return err
 	case <-tail.changes.Truncated:
+		atomic.AddUint64(&tail.stats.truncations, 1)
+		offset, err := tail.Tell()
+		if err != nil {
+			return err
+		}
+		tail.event(Event{Type: FileTruncated, Offset: offset, Size: tail.changes.TruncatedFrom()})
 		// Always reopen files if truncated (Follow is true)
-		tail.Logger.Printf("Re-opening truncated file %s ...", tail.Filename)
+		tail.log.Info("Re-opening truncated file", "file", tail.Filename)
 		if err := tail.reopen(); err != nil {
 			return err
 		}
-		tail.Logger.Printf("Successfully reopened truncated %s", tail.Filename)
+		tail.log.Info("Successfully reopened truncated file", "file", tail.Filename)
+		atomic.AddUint64(&tail.stats.reopens, 1)
 		tail.openReader()
+		tail.sendTruncated(offset, tail.changes.TruncatedFrom())
+		return nil
+	case <-tail.multiline.timeout():
+		tail.sendEvent()
+		return nil
+	case <-tail.partialTimeout():
+		return nil
+	case <-tail.batcher.timeout():
+		tail.flushBatch()
 		return nil
 	case <-tail.Dying():
 		return ErrStop
@@ -394,13 +1164,38 @@ func (tail *Tail) waitForChanges() error {
 	panic("unreachable")
 }
 
+// sendTruncated reports, with TruncateMarker, the truncation of the file
+// from size bytes while it was read up to offset.
+func (tail *Tail) sendTruncated(offset, size int64) {
+	if !tail.TruncateMarker {
+		return
+	}
+	err := &TruncationError{Filename: tail.Filename, Offset: offset}
+	if size > offset {
+		err.Lost = size - offset
+	}
+	tail.send(&Line{Text: []byte(err.Error()), Err: err, Filename: tail.Filename, Time: time.Now()})
+}
+
 func (tail *Tail) openReader() {
+	tail.detectEncoding()
+	tail.delim, tail.cr = tail.delimiter()
 
-	if tail.MaxLineSize > 0 {
-		// add 2 to account for newline characters
-		tail.reader = bufio.NewReaderSize(tail.File, tail.MaxLineSize)
+	if tail.Split != nil {
+		size := tail.MaxLineSize
+		if size <= 0 {
+			size = bufio.MaxScanTokenSize
+		}
+		tail.reader = bufio.NewReaderSize(tail.input(), size)
+	} else if tail.MaxLineSize > 0 {
+		size := tail.MaxLineSize
+		if tail.LongLines != ReassembleLongLines {
+			// add room for the delimiter and a carriage return
+			size += len(tail.delim) + len(tail.cr)
+		}
+		tail.reader = bufio.NewReaderSize(tail.input(), size)
 	} else {
-		tail.reader = bufio.NewReader(tail.File)
+		tail.reader = bufio.NewReader(tail.input())
 	}
 }
 
@@ -409,26 +1204,108 @@ func (tail *Tail) seekEnd() error {
 }
 
 func (tail *Tail) seekTo(pos SeekInfo) error {
-	_, err := tail.File.Seek(pos.Offset, pos.Whence)
+	_, err := tail.input().Seek(pos.Offset, pos.Whence)
 	if err != nil {
 		return fmt.Errorf("Seek error on %s: %s", tail.Filename, err)
 	}
 	// Reset the read buffer whenever the file is re-seek'ed
-	tail.reader.Reset(tail.File)
+	tail.reader.Reset(tail.input())
 	return nil
 }
 
-// sendLine sends the line(s) to Lines channel, splitting longer lines
-// if necessary. Return false if rate limit is reached.
-func (tail *Tail) sendLine(line []byte) bool {
+// sendLine fills in the metadata of a line read from offset up to end and
+// sends it to the Lines channel, or groups it into a multiline event.
+// Return false if rate limit is reached.
+func (tail *Tail) sendLine(l *Line, offset, end int64) bool {
+
+	tail.decodeLine(l)
+	if tail.pastUntil(l) {
+		// left for a tail of a later time range
+		tail.keepUnsent(offset)
+		tail.sendEvent()
+		tail.Kill(nil)
+		return true
+	}
+	l.Filename = tail.Filename
+	l.FileID = tail.id
+	l.Offset = offset
+	l.Time = time.Now()
+	l.Part = tail.part
+	if l.Partial {
+		tail.part++
+	} else {
+		tail.part = 0
+	}
+	n := int64(len(l.Text))
+	if !tail.Pipe {
+		l.EndOffset = end
+		n = end - offset
+	}
+	tail.countLine(l, n)
 
-	tail.Lines <- &Line{line, nil}
+	if tail.multiline == nil {
+		return tail.deliver(l)
+	}
+	ok := true
+	for _, event := range tail.multiline.add(l) {
+		ok = tail.deliver(event) && ok
+	}
+	return ok
+}
+
+// deliver parses and processes a line, or multiline event, and sends it to
+// the Lines channel. Return false if rate limit is reached.
+func (tail *Tail) deliver(l *Line) bool {
+	tail.parse(l)
+	end := l.EndOffset
+	if l = tail.process(l); l == nil {
+		tail.skipTo(end)
+		return true
+	}
+	tail.num++
+	l.Num = tail.num
+	l.tail = tail
+
+	ok, stopped := tail.pour(l.Text)
+	if stopped {
+		// left to be read by the next tail
+		tail.keepUnsent(l.Offset)
+		return false
+	}
+	if !ok {
+		if tail.RateLimitPolicy == RateLimitDrop {
+			tail.dropped++
+		}
+		tail.skipTo(l.EndOffset)
+		return false
+	}
+	tail.sendDropped()
+
+	if tail.checkpoint != nil && tail.ExplicitCommit {
+		if tail.cursor != nil {
+			// processed once queued; lines are committed in the queue
+			tail.checkpoint.skip(tail.position(l.EndOffset))
+		} else {
+			tail.checkpoint.track(l, tail.position(l.EndOffset))
+		}
+	}
+
+	tail.send(l)
 
 	// log.Println("line sent:", string(line))
 
 	return true
 }
 
+// keepUnsent records that the line at offset was read, but not sent as
+// the tail stops, for the position saved to be before it.
+func (tail *Tail) keepUnsent(offset int64) {
+	if !tail.unsent {
+		tail.unsent = true
+		tail.unsentAt = offset
+	}
+}
+
 // Cleanup removes inotify watches added by the tail package. This function is
 // meant to be invoked from a process's exit handler. Linux kernel may not
 // automatically remove inotify watches after the process exits.
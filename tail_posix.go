@@ -4,8 +4,18 @@ package tail
 
 import (
 	"os"
+	"syscall"
 )
 
 func OpenFile(name string) (file *os.File, err error) {
 	return os.Open(name)
 }
+
+// fileIDOf returns the device and inode numbers of the file described by fi.
+func fileIDOf(fi os.FileInfo) FileID {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileID{}
+	}
+	return FileID{Dev: uint64(st.Dev), Ino: uint64(st.Ino)}
+}
@@ -0,0 +1,46 @@
+// +build linux darwin freebsd netbsd openbsd
+
+package tail
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	tailTest := NewTailTest("pipe", t)
+	name := tailTest.path + "/fifo"
+	os.Remove(name)
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(name)
+
+	tail, err := TailFile(name, Config{Pipe: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lines are sent as they arrive, while the writer keeps the pipe open
+	for _, text := range []string{"hello", "world"} {
+		if _, err := w.WriteString(text + "\n"); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case line := <-tail.Lines:
+			if string(line.Text) != text {
+				t.Errorf("expected %q, got %q", text, line.Text)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not sent before the pipe was closed", text)
+		}
+	}
+	w.Close()
+	tail.Stop()
+}
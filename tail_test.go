@@ -7,15 +7,27 @@
 package tail
 
 import (
-	_ "fmt"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf16"
 
-	// "github.com/pavamana1123/tail/ratelimiter"
+	"github.com/pavamana1123/tail/ratelimiter"
 	"github.com/pavamana1123/tail/util"
 	"github.com/pavamana1123/tail/watch"
 )
@@ -54,6 +66,13 @@ func TestMustExist(t *testing.T) {
 	tail.Cleanup()
 }
 
+func TestReOpenWithoutFollow(t *testing.T) {
+	_, err := TailFile("README.md", Config{ReOpen: true})
+	if err != ErrReOpenWithoutFollow {
+		t.Errorf("expected ErrReOpenWithoutFollow, got %v", err)
+	}
+}
+
 func TestWaitsForFileToExist(t *testing.T) {
 	tailTest := NewTailTest("waits-for-file-to-exist", t)
 	tail := tailTest.StartTail("test.txt", Config{})
@@ -99,6 +118,25 @@ func TestStop(t *testing.T) {
 	tail.Cleanup()
 }
 
+func TestTailFileContext(t *testing.T) {
+	tailTest := NewTailTest("tail-file-context", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	ctx, cancel := context.WithCancel(context.Background())
+	tail, err := TailFileContext(ctx, tailTest.path+"/test.txt", Config{Follow: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tailTest.ReadLines(tail, []string{"hello"})
+
+	cancel()
+	for range tail.Lines {
+	}
+	if err := tail.Wait(); err != context.Canceled {
+		t.Errorf("expected context.Canceled from Wait, got %v", err)
+	}
+	tail.Cleanup()
+}
+
 func TestStopAtEOF(t *testing.T) {
 	tailTest := NewTailTest("maxlinesize", t)
 	tailTest.CreateFile("test.txt", "hello\nthere\nworld\n")
@@ -106,7 +144,7 @@ func TestStopAtEOF(t *testing.T) {
 
 	// read "hello"
 	line := <-tail.Lines
-	if line.Text != "hello" {
+	if string(line.Text) != "hello" {
 		t.Errorf("Expected to get 'hello', got '%s' instead", line.Text)
 	}
 
@@ -124,6 +162,982 @@ func TestMaxLineSizeNoFollow(t *testing.T) {
 	maxLineSize(t, false, "hello\nworld\nfin\nhe", []string{"hel", "lo", "wor", "ld", "fin", "he"})
 }
 
+func TestLongLinePolicies(t *testing.T) {
+	tailTest := NewTailTest("long-line-policies", t)
+	tailTest.CreateFile("test.txt", "hello\r\nworld!\nfin\n")
+
+	type part struct {
+		text               string
+		part               int
+		partial, truncated bool
+	}
+	for _, c := range []struct {
+		config   Config
+		expected []part
+	}{
+		{Config{MaxLineSize: 4},
+			[]part{{"hell", 0, true, false}, {"o", 1, false, false},
+				{"worl", 0, true, false}, {"d!", 1, false, false}, {"fin", 0, false, false}}},
+		{Config{MaxLineSize: 4, LongLines: TruncateLongLines},
+			[]part{{"hell", 0, false, true}, {"worl", 0, false, true}, {"fin", 0, false, false}}},
+		{Config{MaxLineSize: 4, LongLines: ReassembleLongLines, MaxLineCap: 5},
+			[]part{{"hello", 0, false, false}, {"world", 0, true, false},
+				{"!", 1, false, false}, {"fin", 0, false, false}}},
+	} {
+		tail := tailTest.StartTail("test.txt", c.config)
+		for _, e := range c.expected {
+			line := <-tail.Lines
+			got := part{string(line.Text), line.Part, line.Partial, line.Truncated}
+			if got != e {
+				t.Errorf("%+v: expected %+v, got %+v", c.config, e, got)
+			}
+		}
+		tail.Wait()
+	}
+	tailTest.RemoveFile("test.txt")
+}
+
+func TestRecordDelimiters(t *testing.T) {
+	long := strings.Repeat("x", 20)
+	tests := []struct {
+		config  Config
+		content string
+		want    []string
+	}{
+		{Config{Delimiter: "\x00"}, "a\x00b\r\x00\x00c", []string{"a", "b\r", "", "c"}},
+		{Config{Delimiter: "<>"}, "a<>b<c><>" + long + "<>d", []string{"a", "b<c>", long, "d"}},
+		{Config{Delimiter: "<>", MaxLineSize: 16}, long + "<>d<>", []string{long[:16], long[16:], "d"}},
+		{Config{Delimiter: "<>", MaxLineSize: 16, LongLines: TruncateLongLines}, long + "<>d<>", []string{long[:16], "d"}},
+		{Config{Split: bufio.ScanWords}, " a  bc\nd ", []string{"a", "bc", "d"}},
+		{Config{Split: ScanLengthPrefixed(2, binary.BigEndian)}, "\x00\x02ab\x00\x00\x00\x03c\x00d", []string{"ab", "", "c\x00d"}},
+	}
+
+	tailTest := NewTailTest("record-delimiters", t)
+	for i, test := range tests {
+		tailTest.CreateFile("test.txt", test.content)
+		tail := tailTest.StartTail("test.txt", test.config)
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: expected %q, got %q", i, test.want, got)
+		}
+		tailTest.Cleanup(tail, false)
+	}
+}
+
+func TestSplitFollow(t *testing.T) {
+	tailTest := NewTailTest("split-follow", t)
+	tailTest.CreateFile("test.txt", "\x03abc\x05de")
+	tail := tailTest.StartTail(
+		"test.txt",
+		Config{Follow: true, Split: ScanLengthPrefixed(1, binary.BigEndian)})
+	tailTest.ReadLines(tail, []string{"abc"})
+
+	// the incomplete record is read again once complete
+	<-time.After(100 * time.Millisecond)
+	tailTest.AppendFile("test.txt", "fgh")
+	tailTest.ReadLines(tail, []string{"defgh"})
+	tailTest.Cleanup(tail, true)
+}
+
+func TestMultiline(t *testing.T) {
+	trace := "Exception in thread \"main\" java.lang.NullPointerException\n" +
+		"\tat com.example.Foo.bar(Foo.java:16)\n" +
+		"\tat com.example.Foo.main(Foo.java:5)\n"
+	tests := []struct {
+		multiline Multiline
+		content   string
+		want      []string
+	}{
+		{Multiline{Indented: true}, "start\n" + trace + "end\n",
+			[]string{"start", strings.TrimSuffix(trace, "\n"), "end"}},
+		{Multiline{Start: regexp.MustCompile(`^\d`)}, "1 a\nb\nc\n2 d\n",
+			[]string{"1 a\nb\nc", "2 d"}},
+		{Multiline{Continue: regexp.MustCompile(`^Caused by`)}, "a\nCaused by: b\nc\n",
+			[]string{"a\nCaused by: b", "c"}},
+		{Multiline{Start: regexp.MustCompile(`^BEGIN`), End: regexp.MustCompile(`^END`)}, "BEGIN\nx\nEND\ny\n",
+			[]string{"BEGIN\nx\nEND", "y"}},
+		{Multiline{Indented: true, MaxLines: 2}, trace,
+			[]string{"Exception in thread \"main\" java.lang.NullPointerException\n\tat com.example.Foo.bar(Foo.java:16)"}},
+		{Multiline{Indented: true, MaxBytes: 12}, trace,
+			[]string{"Exception in"}},
+	}
+
+	tailTest := NewTailTest("multiline", t)
+	for i, test := range tests {
+		tailTest.CreateFile("test.txt", test.content)
+		multiline := test.multiline
+		tail := tailTest.StartTail("test.txt", Config{Multiline: &multiline})
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: expected %q, got %q", i, test.want, got)
+		}
+		tailTest.Cleanup(tail, false)
+	}
+}
+
+func TestMultilineTimeout(t *testing.T) {
+	tailTest := NewTailTest("multiline-timeout", t)
+	tailTest.CreateFile("test.txt", "a\n b\nc\n d\n")
+	tail := tailTest.StartTail(
+		"test.txt",
+		Config{Follow: true, Multiline: &Multiline{Indented: true, Timeout: 100 * time.Millisecond}})
+
+	// the last event is sent once the file goes quiet
+	tailTest.ReadLines(tail, []string{"a\n b"})
+	line := <-tail.Lines
+	if string(line.Text) != "c\n d" || line.Offset != 5 || line.EndOffset != 10 {
+		t.Fatalf("expected c\\n d at 5-10, got %q at %d-%d", line.Text, line.Offset, line.EndOffset)
+	}
+	tailTest.Cleanup(tail, true)
+}
+
+func TestEncodings(t *testing.T) {
+	utf16le := func(s string) string {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		return string(b)
+	}
+	utf16be := func(s string) string {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u>>8), byte(u))
+		}
+		return string(b)
+	}
+	tests := []struct {
+		config  Config
+		content string
+		want    []string
+	}{
+		{Config{Encoding: "utf-16"}, "\xff\xfe" + utf16le("h\u00e9llo\r\nw\u00f6rld\n"), []string{"h\u00e9llo", "w\u00f6rld"}},
+		{Config{Encoding: "utf-16le"}, "\xfe\xff" + utf16be("a\nb\n"), []string{"a", "b"}},
+		{Config{Encoding: "utf-16le"}, utf16le("\u0a05\u0100\n\U0001f600\n"), []string{"\u0a05\u0100", "\U0001f600"}},
+		{Config{Encoding: "utf-16be", MaxLineSize: 5}, utf16be("abc\n"), []string{"ab", "c"}},
+		{Config{Encoding: "utf-8"}, "\xef\xbb\xbfa\n", []string{"a"}},
+		{Config{Encoding: "latin1"}, "caf\xe9\n", []string{"caf\u00e9"}},
+		{Config{Encoding: "shift_jis"}, "\x93\xfa\x96{\x8c\xea\n\x83\x5c\n", []string{"\u65e5\u672c\u8a9e", "\u30bd"}},
+		{Config{InvalidUTF8: ReplaceInvalidUTF8}, "a\xffb\n", []string{"a\ufffdb"}},
+	}
+
+	tailTest := NewTailTest("encodings", t)
+	for i, test := range tests {
+		tailTest.CreateFile("test.txt", test.content)
+		tail := tailTest.StartTail("test.txt", test.config)
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: expected %q, got %q", i, test.want, got)
+		}
+		tailTest.Cleanup(tail, false)
+	}
+
+	tailTest.CreateFile("test.txt", "ok\na\xffb\n")
+	tail := tailTest.StartTail("test.txt", Config{InvalidUTF8: ReportInvalidUTF8})
+	<-tail.Lines
+	if err, ok := (<-tail.Lines).Err.(*InvalidUTF8Error); !ok || err.Index != 1 {
+		t.Errorf("expected an InvalidUTF8Error at 1, got %v", err)
+	}
+	tailTest.Cleanup(tail, true)
+
+	if _, err := TailFile("test.txt", Config{Encoding: "euc-jp"}); err == nil {
+		t.Error("expected an error for an encoding not registered")
+	}
+	RegisterEncoding("X-Upper", func(b []byte) ([]byte, error) { return bytes.ToUpper(b), nil })
+	tailTest.CreateFile("test.txt", "hello\n")
+	tail = tailTest.StartTail("test.txt", Config{Encoding: "x-upper"})
+	tailTest.VerifyTailOutput(tail, []string{"HELLO"}, true)
+	tailTest.RemoveFile("test.txt")
+}
+
+func TestPartialLineTimeout(t *testing.T) {
+	for _, cont := range []bool{false, true} {
+		tailTest := NewTailTest("partial-line-timeout", t)
+		tailTest.CreateFile("test.txt", "a\nprompt> ")
+		tail := tailTest.StartTail(
+			"test.txt",
+			Config{Follow: true, PartialLineTimeout: 100 * time.Millisecond, ContinuePartialLines: cont})
+		tailTest.ReadLines(tail, []string{"a"})
+
+		line := <-tail.Lines
+		if string(line.Text) != "prompt> " || !line.Partial || line.EndOffset != 10 {
+			t.Fatalf("expected a partial line up to 10, got %+v", line)
+		}
+		tailTest.AppendFile("test.txt", "yes\n")
+		line = <-tail.Lines
+		wantPart := 0
+		if cont {
+			wantPart = 1
+		}
+		if string(line.Text) != "yes" || line.Partial || line.Part != wantPart || line.Offset != 10 {
+			t.Fatalf("expected yes as part %d at 10, got %+v", wantPart, line)
+		}
+		tailTest.Cleanup(tail, true)
+	}
+}
+
+func TestCompressedFile(t *testing.T) {
+	tailTest := NewTailTest("compressed-file", t)
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte("hello\nworld\nagain\n"))
+	w.Close()
+	tailTest.CreateFile("test.txt.gz", buf.String())
+
+	// offsets are in the decompressed content
+	tail := tailTest.StartTail(
+		"test.txt.gz",
+		Config{Location: &SeekInfo{Offset: 6, Whence: os.SEEK_SET}})
+	line := <-tail.Lines
+	if string(line.Text) != "world" || line.Offset != 6 || line.EndOffset != 12 {
+		t.Fatalf("expected world at 6-12, got %q at %d-%d", line.Text, line.Offset, line.EndOffset)
+	}
+	tailTest.VerifyTailOutput(tail, []string{"again"}, true)
+	tailTest.Cleanup(tail, false)
+}
+
+func TestCompressedResume(t *testing.T) {
+	gz := func(s string) string {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		w.Write([]byte(s))
+		w.Close()
+		return buf.String()
+	}
+	// "a\nb\n" and "c\nd\n" in two frames, and "e\n" in another one
+	// appended to them
+	tests := []struct {
+		format              string
+		first, second, more string
+	}{
+		{"gzip", gz("a\nb\n"), gz("c\nd\n"), gz("e\n")},
+		{"zstd",
+			"\x28\xb5\x2f\xfd\x04\x58\x21\x00\x00\x61\x0a\x62\x0a\x25\x50\xb3\x23",
+			"\x28\xb5\x2f\xfd\x04\x58\x21\x00\x00\x63\x0a\x64\x0a\xdb\xeb\x6f\x1d",
+			"\x28\xb5\x2f\xfd\x04\x58\x11\x00\x00\x65\x0a\xb9\x80\xdf\x18"},
+		// blocks of a stream, then another stream
+		{"xz",
+			"\xfd\x37\x7a\x58\x5a\x00\x00\x04\xe6\xd6\xb4\x46\x02\xc0\x08\x04\x21\x01\x16\x00\x89\x74\x1d\xf7" +
+				"\x01\x00\x03\x61\x0a\x62\x0a\x00\x44\x8e\x2c\xb5\xad\xa0\xcd\xac",
+			"\x02\xc0\x08\x04\x21\x01\x16\x00\x89\x74\x1d\xf7\x01\x00\x03\x63\x0a\x64\x0a\x00\x57\xf5\x99\x94" +
+				"\x57\x0e\xbf\xff\x00\x02\x1c\x04\x1c\x04\x00\x00\x9b\xea\xef\x6e\xb1\xc4\x67\xfb\x02\x00\x00\x00" +
+				"\x00\x04\x59\x5a",
+			"\xfd\x37\x7a\x58\x5a\x00\x00\x04\xe6\xd6\xb4\x46\x04\xc0\x06\x02\x21\x01\x16\x00\x00\x00\x00\x00" +
+				"\x00\x00\x00\x00\x11\xcb\xc2\x4c\x01\x00\x01\x65\x0a\x00\x00\x00\xa2\x9d\x72\x64\xf1\xd4\x38\x15" +
+				"\x00\x01\x22\x02\x27\x92\x3a\x69\x1f\xb6\xf3\x7d\x01\x00\x00\x00\x00\x04\x59\x5a"},
+	}
+	registered := make(map[string]bool)
+	for _, c := range compressions {
+		registered[c.name] = true
+	}
+
+	tailTest := NewTailTest("compressed-resume", t)
+	config := Config{PosFile: tailTest.path + "/test.pos"}
+	readAll := func() []string {
+		tail := tailTest.StartTail("test.log.z", config)
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if err := tail.Err(); err != nil {
+			t.Errorf("tail ended with error: %v", err)
+		}
+		tailTest.Cleanup(tail, false)
+		return got
+	}
+	for _, test := range tests {
+		if !registered[test.format] {
+			t.Logf("%s files are not read with this version of Go", test.format)
+			continue
+		}
+		os.Remove(config.PosFile)
+		tailTest.CreateFile("test.log.z", test.first+test.second)
+		if got := readAll(); !reflect.DeepEqual(got, []string{"a", "b", "c", "d"}) {
+			t.Errorf("%s: expected a, b, c and d, got %q", test.format, got)
+		}
+		pos, err := readPosFile(config.PosFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := (frame{int64(len(test.first)), 4}); pos == nil || pos.Frame != want {
+			t.Fatalf("%s: expected the position in the frame at %v, got %+v", test.format, want, pos)
+		}
+
+		// resumed from the second frame: the first one, which no longer
+		// passes its check, is not decompressed again
+		f, err := os.OpenFile(tailTest.path+"/test.log.z", os.O_WRONLY, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteAt([]byte{^test.first[len(test.first)-1]}, int64(len(test.first)-1))
+		f.WriteAt([]byte(test.more), int64(len(test.first+test.second)))
+		f.Close()
+		if got := readAll(); !reflect.DeepEqual(got, []string{"e"}) {
+			t.Errorf("%s: expected e, got %q", test.format, got)
+		}
+	}
+	tailTest.RemoveFile("test.log.z")
+}
+
+func TestLineLocation(t *testing.T) {
+	var long bytes.Buffer
+	for i := 1; i <= 20000; i++ {
+		fmt.Fprintf(&long, "line %d\n", i)
+	}
+	utf16le := func(s string) string {
+		var b []byte
+		for _, u := range utf16.Encode([]rune(s)) {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		return string(b)
+	}
+	tests := []struct {
+		config  Config
+		content string
+		want    []string
+	}{
+		// spans several blocks
+		{Config{LineLocation: &LineLocation{Lines: 2}}, long.String(), []string{"line 19999", "line 20000"}},
+		{Config{LineLocation: &LineLocation{Lines: 9000}}, long.String(), nil},
+		{Config{LineLocation: &LineLocation{Lines: 2}}, "a\nb\nc", []string{"b", "c"}},
+		{Config{LineLocation: &LineLocation{Lines: 5}}, "a\r\nb\r\n", []string{"a", "b"}},
+		{Config{LineLocation: &LineLocation{Lines: 0}}, "a\nb\n", nil},
+		{Config{LineLocation: &LineLocation{Lines: 1}, Delimiter: "::"}, "a::b:::c::", []string{"c"}},
+		{Config{LineLocation: &LineLocation{Lines: 2}, Encoding: "utf-16"}, "\xff\xfe" + utf16le("a\n\u0a00\nc\n"), []string{"\u0a00", "c"}},
+		{Config{LineLocation: &LineLocation{Lines: 3, FromStart: true}}, "a\nb\nc\nd\n", []string{"c", "d"}},
+		{Config{LineLocation: &LineLocation{Lines: 1, FromStart: true}}, "a\nb\n", []string{"a", "b"}},
+		{Config{LineLocation: &LineLocation{Lines: 9, FromStart: true}}, "a\nb\n", nil},
+		// overrides Location
+		{Config{LineLocation: &LineLocation{Lines: 1}, Location: &SeekInfo{Offset: 0, Whence: os.SEEK_SET}}, "a\nb\n", []string{"b"}},
+	}
+	tests[1].want = strings.Split(strings.TrimSuffix(long.String(), "\n"), "\n")[11000:]
+
+	tailTest := NewTailTest("line-location", t)
+	for i, test := range tests {
+		tailTest.CreateFile("test.txt", test.content)
+		tail := tailTest.StartTail("test.txt", test.config)
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: expected %q, got %q", i, test.want, got)
+		}
+		tailTest.Cleanup(tail, false)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(long.Bytes())
+	w.Close()
+	tailTest.CreateFile("test.txt.gz", buf.String())
+	tail := tailTest.StartTail("test.txt.gz", Config{LineLocation: &LineLocation{Lines: 1}})
+	tailTest.VerifyTailOutput(tail, []string{"line 20000"}, true)
+	tailTest.Cleanup(tail, false)
+
+	if _, err := TailFile("test.txt", Config{LineLocation: &LineLocation{}, Split: bufio.ScanWords}); err != ErrLineLocationWithSplit {
+		t.Errorf("expected ErrLineLocationWithSplit, got %v", err)
+	}
+}
+
+func TestTimeRange(t *testing.T) {
+	base := time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)
+	at := func(i int) time.Time { return base.Add(time.Duration(i) * time.Second) }
+	var log, header bytes.Buffer
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&log, "%s line %d\n", at(i).Format(time.RFC3339), i)
+		if i%7 == 0 {
+			fmt.Fprintf(&log, "\tat frame %d\n", i)
+		}
+	}
+	for header.Len() < 3*lineBlockSize {
+		header.WriteString("no timestamp here\n")
+	}
+	lines := func(from, to int) []string {
+		var want []string
+		for i := from; i < to; i++ {
+			want = append(want, fmt.Sprintf("%s line %d", at(i).Format(time.RFC3339), i))
+			if i%7 == 0 {
+				want = append(want, fmt.Sprintf("\tat frame %d", i))
+			}
+		}
+		return want
+	}
+	tests := []struct {
+		config  Config
+		content string
+		want    []string
+	}{
+		{Config{TimeRange: &TimeRange{Since: at(15000)}}, log.String(), lines(15000, 20000)},
+		{Config{TimeRange: &TimeRange{Since: at(12345).Add(-time.Millisecond)}}, log.String(), lines(12345, 20000)},
+		{Config{TimeRange: &TimeRange{Since: at(-1)}}, log.String(), lines(0, 20000)},
+		{Config{TimeRange: &TimeRange{Since: at(20000)}}, log.String(), nil},
+		{Config{TimeRange: &TimeRange{Since: at(7), Until: at(9)}}, log.String(), lines(7, 10)},
+		{Config{TimeRange: &TimeRange{Until: at(1)}}, log.String(), lines(0, 2)},
+		{Config{TimeRange: &TimeRange{Since: at(19990)}}, header.String() + log.String(), lines(19990, 20000)},
+		{Config{TimeRange: &TimeRange{Since: at(1), Layout: "Jan _2 15:04:05", Location: time.UTC}},
+			"Oct 17 00:00:00 a\nOct 17 00:00:01 b\nOct 17 00:00:02 c\n", []string{"Oct 17 00:00:01 b", "Oct 17 00:00:02 c"}},
+		{Config{TimeRange: &TimeRange{Since: at(1), Pattern: regexp.MustCompile(`ts=(\S+)`)}},
+			"a ts=2026-10-17T00:00:00Z\nb ts=2026-10-17T00:00:01Z\n", []string{"b ts=2026-10-17T00:00:01Z"}},
+	}
+
+	tailTest := NewTailTest("time-range", t)
+	for i, test := range tests {
+		tailTest.CreateFile("test.txt", test.content)
+		tail := tailTest.StartTail("test.txt", test.config)
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: expected %d lines from %q, got %d from %q", i, len(test.want), first(test.want), len(got), first(got))
+		}
+		tailTest.Cleanup(tail, false)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(log.Bytes())
+	w.Close()
+	tailTest.CreateFile("test.txt.gz", buf.String())
+	tail := tailTest.StartTail("test.txt.gz", Config{TimeRange: &TimeRange{Since: at(19998)}})
+	tailTest.VerifyTailOutput(tail, lines(19998, 20000), true)
+	tailTest.Cleanup(tail, false)
+}
+
+func TestTimeRangePosFile(t *testing.T) {
+	tailTest := NewTailTest("time-range-posfile", t)
+	tailTest.CreateFile("test.txt", "2026-10-17T00:00:00Z a\n2026-10-17T00:00:01Z b\n2026-10-17T00:00:02Z c\n")
+	config := Config{
+		PosFile:   tailTest.path + "/test.pos",
+		TimeRange: &TimeRange{Until: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)}}
+	os.Remove(config.PosFile)
+	tail := tailTest.StartTail("test.txt", config)
+	tailTest.VerifyTailOutput(tail, []string{"2026-10-17T00:00:00Z a"}, true)
+	tail.Wait()
+
+	// the first line past Until is read again on resume
+	config.TimeRange = nil
+	tail = tailTest.StartTail("test.txt", config)
+	tailTest.ReadLines(tail, []string{"2026-10-17T00:00:01Z b", "2026-10-17T00:00:02Z c"})
+	tail.Stop()
+	tailTest.RemoveFile("test.txt")
+}
+
+func first(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return lines[0]
+}
+
+func TestParsers(t *testing.T) {
+	year := time.Now().Year()
+	tests := []struct {
+		parse ParseFunc
+		text  string
+		want  map[string]interface{}
+		err   bool
+	}{
+		{ParseJSON, `{"level":"info","n":1,"tags":["a"]}`,
+			map[string]interface{}{"level": "info", "n": 1.0, "tags": []interface{}{"a"}}, false},
+		{ParseJSON, `[1]`, nil, true},
+		{ParseJSON, `null`, nil, true},
+		{ParseLogfmt, `level=info msg="hello \"world\"" empty= debug`,
+			map[string]interface{}{"level": "info", "msg": `hello "world"`, "empty": "", "debug": true}, false},
+		{ParseLogfmt, `a=1 msg="oops`, map[string]interface{}{"a": "1"}, true},
+		{ParseLogfmt, `a=1 =2`, map[string]interface{}{"a": "1"}, true},
+		{ParseRegexp(regexp.MustCompile(`^(?P<level>\w+): (?P<msg>.*?)(?: \((?P<code>\d+)\))?$`)), "ERROR: disk full",
+			map[string]interface{}{"level": "ERROR", "msg": "disk full"}, false},
+		{ParseRegexp(regexp.MustCompile(`^(?P<level>\w+):`)), "nope", nil, true},
+		{ParseCombinedLog, `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			map[string]interface{}{
+				"remote_addr": "127.0.0.1", "user": "frank", "time": "2000-10-10T13:55:36-07:00",
+				"request": "GET /apache_pb.gif HTTP/1.0", "method": "GET", "path": "/apache_pb.gif", "protocol": "HTTP/1.0",
+				"status": 200, "bytes": 2326, "referer": "http://www.example.com/start.html", "user_agent": "Mozilla/4.08 [en] (Win98; I ;Nav)",
+			}, false},
+		{ParseCombinedLog, `10.0.0.1 - - [10/Oct/2000:13:55:36 +0000] "-" 400 -`,
+			map[string]interface{}{"remote_addr": "10.0.0.1", "time": "2000-10-10T13:55:36Z", "status": 400}, false},
+		{ParseCombinedLog, `not an access log`, nil, true},
+		{ParseSyslog, `<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su - ID47 [exampleSDID@32473 iut="3" eventSource="Appl\]ication"] ` + "\ufeff'su root' failed",
+			map[string]interface{}{
+				"priority": 34, "facility": 4, "severity": 2, "timestamp": "2003-10-11T22:14:15Z",
+				"hostname": "mymachine.example.com", "app_name": "su", "msg_id": "ID47",
+				"structured_data": `[exampleSDID@32473 iut="3" eventSource="Appl\]ication"]`, "message": "'su root' failed",
+			}, false},
+		{ParseSyslog, `<165>1 2003-08-24T05:14:15.000003-07:00 192.0.2.1 myproc 8710 - - %% It's time to make the do-nuts.`,
+			map[string]interface{}{
+				"priority": 165, "facility": 20, "severity": 5, "timestamp": "2003-08-24T05:14:15-07:00",
+				"hostname": "192.0.2.1", "app_name": "myproc", "proc_id": "8710", "message": "%% It's time to make the do-nuts.",
+			}, false},
+		{ParseSyslog, `Oct  7 06:25:01 host CRON[1234]: (root) CMD (command)`,
+			map[string]interface{}{
+				"timestamp": time.Date(year, 10, 7, 6, 25, 1, 0, time.Local).Format(time.RFC3339),
+				"hostname":  "host", "app_name": "CRON", "proc_id": "1234", "message": "(root) CMD (command)",
+			}, false},
+		{ParseSyslog, `<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!`,
+			map[string]interface{}{
+				"priority": 13, "facility": 1, "severity": 5, "timestamp": time.Date(year, 2, 5, 17, 32, 18, 0, time.Local).Format(time.RFC3339),
+				"hostname": "10.0.0.99", "message": "Use the BFG!",
+			}, false},
+		{ParseSyslog, `<999>1 - - - - - -`, nil, true},
+	}
+
+	for i, test := range tests {
+		fields, err := test.parse([]byte(test.text))
+		if (err != nil) != test.err {
+			t.Errorf("test %d: expected error %v, got %v", i, test.err, err)
+		}
+		for k, v := range fields {
+			if ts, ok := v.(time.Time); ok {
+				fields[k] = ts.Format(time.RFC3339)
+			}
+		}
+		if len(fields) != 0 || len(test.want) != 0 {
+			if !reflect.DeepEqual(fields, test.want) {
+				t.Errorf("test %d: expected %v, got %v", i, test.want, fields)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tailTest := NewTailTest("parse", t)
+	tailTest.CreateFile("test.txt", "a=1\nb=\"\nc=3\n")
+	tail := tailTest.StartTail("test.txt", Config{Parse: ParseLogfmt})
+	if line := <-tail.Lines; !reflect.DeepEqual(line.Fields, map[string]interface{}{"a": "1"}) || line.Err != nil {
+		t.Errorf("expected a=1, got %v (%v)", line.Fields, line.Err)
+	}
+	if line := <-tail.Lines; line.Err == nil {
+		t.Error("expected a ParseError")
+	} else if _, ok := line.Err.(*ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", line.Err)
+	}
+	if line := <-tail.Lines; line.Fields["c"] != "3" {
+		t.Errorf("expected c=3 after a parse error, got %v", line.Fields)
+	}
+	tailTest.Cleanup(tail, true)
+}
+
+func TestProcessors(t *testing.T) {
+	content := "level=debug msg=a\n" +
+		"level=info msg=b\n" +
+		"level=error msg=\"card 4111 1111 1111 1111, not 4111 1111 1111 1112\"\n" +
+		"level=info msg=c\n" +
+		"level=info msg=\"Authorization: Bearer abc.DEF-123=\"\n" +
+		"level=warn msg=d\n"
+	tests := []struct {
+		processors []Processor
+		want       []string
+	}{
+		{[]Processor{Exclude(regexp.MustCompile(`level=(debug|info)`))}, []string{"error", "warn"}},
+		{[]Processor{Include(regexp.MustCompile(`msg=[a-d]$`)), Sample(2)}, []string{"debug", "info"}},
+		{[]Processor{FieldMatches("level", regexp.MustCompile(`^(error|info)$`)), RedactSecrets}, []string{"info", "error", "info", "info"}},
+		{[]Processor{Filter(func(l *Line) bool { return l.Fields["msg"] == "d" })}, []string{"warn"}},
+	}
+
+	tailTest := NewTailTest("processors", t)
+	tailTest.CreateFile("test.txt", content)
+	for i, test := range tests {
+		tail := tailTest.StartTail("test.txt", Config{Parse: ParseLogfmt, Processors: test.processors})
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, line.Fields["level"].(string))
+			if line.Num != uint64(len(got)) {
+				t.Errorf("test %d: expected line %d, got %d", i, len(got), line.Num)
+			}
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("test %d: expected %q, got %q", i, test.want, got)
+		}
+		tailTest.Cleanup(tail, false)
+	}
+
+	l := RedactSecrets.Process(&Line{
+		Text:   []byte("card 4111-1111-1111-1111 Bearer abc.DEF-123= 4111 1111 1111 1112"),
+		Fields: map[string]interface{}{"auth": "bearer xyz", "n": 1},
+	})
+	if want := "card [REDACTED] Bearer [REDACTED] 4111 1111 1111 1112"; string(l.Text) != want {
+		t.Errorf("expected %q, got %q", want, l.Text)
+	}
+	if l.Fields["auth"] != "bearer [REDACTED]" || l.Fields["n"] != 1 {
+		t.Errorf("expected redacted fields, got %v", l.Fields)
+	}
+	l = Redact(regexp.MustCompile(`pw=\S+`), "pw=***").Process(&Line{Text: []byte("user=a pw=secret")})
+	if string(l.Text) != "user=a pw=***" {
+		t.Errorf("expected the password redacted, got %q", l.Text)
+	}
+}
+
+func TestTailFileBatches(t *testing.T) {
+	tailTest := NewTailTest("tail-file-batches", t)
+	var content bytes.Buffer
+	for i := 0; i < 1050; i++ {
+		fmt.Fprintf(&content, "%04d\n", i)
+	}
+	tailTest.CreateFile("test.txt", content.String())
+
+	tests := []struct {
+		batch Batch
+		sizes []int
+	}{
+		{Batch{}, []int{1000, 50}},
+		{Batch{MaxLines: 500}, []int{500, 500, 50}},
+		{Batch{MaxBytes: 2000}, []int{500, 500, 50}},
+	}
+	for i, test := range tests {
+		var sizes []int
+		n := 0
+		tail, err := TailFileBatches(tailTest.path+"/test.txt", Config{}, test.batch, func(lines []*Line) error {
+			sizes = append(sizes, len(lines))
+			for _, line := range lines {
+				if want := fmt.Sprintf("%04d", n); string(line.Text) != want || line.Num != uint64(n+1) {
+					return fmt.Errorf("expected %s, got %s (%d)", want, line.Text, line.Num)
+				}
+				n++
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tail.Wait(); err != nil {
+			t.Errorf("test %d: %s", i, err)
+		}
+		if !reflect.DeepEqual(sizes, test.sizes) {
+			t.Errorf("test %d: expected batches of %v, got %v", i, test.sizes, sizes)
+		}
+	}
+
+	// an error stops the tail
+	errHandler := errors.New("handler failed")
+	calls := 0
+	tail, err := TailFileBatches(tailTest.path+"/test.txt", Config{Follow: true}, Batch{MaxLines: 10}, func([]*Line) error {
+		calls++
+		return errHandler
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tail.Wait(); err != errHandler || calls != 1 {
+		t.Errorf("expected the handler error after 1 call, got %v after %d", err, calls)
+	}
+	if _, ok := <-tail.Lines; ok {
+		t.Error("expected Lines to be closed")
+	}
+
+	// lines wait up to MaxDelay for more
+	tailTest.CreateFile("test.txt", "")
+	batches := make(chan []*Line, 10)
+	tail, err = TailFileBatches(tailTest.path+"/test.txt", Config{Follow: true}, Batch{MaxDelay: 200 * time.Millisecond}, func(lines []*Line) error {
+		batches <- lines
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-time.After(100 * time.Millisecond)
+	start := time.Now()
+	tailTest.AppendFile("test.txt", "a\n")
+	<-time.After(50 * time.Millisecond)
+	tailTest.AppendFile("test.txt", "b\n")
+	lines := <-batches
+	if len(lines) != 2 || time.Since(start) < 150*time.Millisecond {
+		t.Errorf("expected 2 lines after 200ms, got %d after %s", len(lines), time.Since(start))
+	}
+	tailTest.Cleanup(tail, true)
+}
+
+func TestOverflow(t *testing.T) {
+	tailTest := NewTailTest("overflow", t)
+	var content bytes.Buffer
+	var all []string
+	for i := 0; i < 1000; i++ {
+		fmt.Fprintf(&content, "%d\n", i)
+		all = append(all, fmt.Sprint(i))
+	}
+	tailTest.CreateFile("test.txt", content.String())
+
+	tests := []struct {
+		overflow OverflowPolicy
+		want     []string
+		dropped  uint64
+		spilled  uint64
+	}{
+		{OverflowBlock, all, 0, 0},
+		{OverflowDropNewest, all[:10], 990, 0},
+		{OverflowDropOldest, all[990:], 990, 0},
+		{OverflowSpill, all, 0, 990},
+	}
+	for _, test := range tests {
+		tail := tailTest.StartTail("test.txt", Config{BufferSize: 10, Overflow: test.overflow, SpillDir: tailTest.path})
+		<-time.After(100 * time.Millisecond)
+
+		stats := tail.QueueStats()
+		if stats.Capacity != 10 || stats.Dropped != test.dropped || stats.Spilled != test.spilled {
+			t.Errorf("overflow %d: expected %d dropped and %d spilled lines, got %+v", test.overflow, test.dropped, test.spilled, stats)
+		}
+		if want := len(test.want); test.overflow != OverflowBlock && stats.Depth != want {
+			t.Errorf("overflow %d: expected %d lines waiting, got %d", test.overflow, want, stats.Depth)
+		}
+		var got []string
+		for line := range tail.Lines {
+			got = append(got, string(line.Text))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("overflow %d: expected %d lines, got %d: %q", test.overflow, len(test.want), len(got), got)
+		}
+		if test.overflow == OverflowBlock && tail.QueueStats().Blocked < 50*time.Millisecond {
+			t.Errorf("expected to be blocked for 100ms, got %s", tail.QueueStats().Blocked)
+		}
+		tailTest.Cleanup(tail, false)
+	}
+}
+
+func TestQueue(t *testing.T) {
+	tailTest := NewTailTest("queue", t)
+	var content bytes.Buffer
+	var all []string
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&content, "%d\n", i)
+		all = append(all, fmt.Sprint(i))
+	}
+	tailTest.CreateFile("test.txt", content.String())
+	config := Config{
+		PosFile: tailTest.path + "/test.pos",
+		Queue:   &Queue{Dir: tailTest.path + "/queue", SegmentSize: 512},
+	}
+	os.RemoveAll(config.Queue.Dir)
+	os.Remove(config.PosFile)
+
+	// lines not sent when stopped are sent on restart, after which the
+	// file has nothing left to read
+	tail := tailTest.StartTail("test.txt", config)
+	for i := 0; i < 30; i++ {
+		if line := <-tail.Lines; string(line.Text) != all[i] || line.Num != uint64(i+1) {
+			t.Fatalf("expected line %d %q, got %d %q", i+1, all[i], line.Num, line.Text)
+		}
+	}
+	tail.Stop()
+	if tail.disk.unsynced {
+		t.Error("the position was saved past lines queued but not synced")
+	}
+	tail = tailTest.StartTail("test.txt", config)
+	var got []string
+	for line := range tail.Lines {
+		if line.Num != uint64(31+len(got)) {
+			t.Errorf("expected line %d, got %d", 31+len(got), line.Num)
+		}
+		got = append(got, string(line.Text))
+	}
+	if !reflect.DeepEqual(got, all[30:]) {
+		t.Errorf("expected the last 70 lines, got %q", got)
+	}
+	tail.Cleanup()
+
+	// with ExplicitCommit, lines not committed are sent again
+	os.RemoveAll(config.Queue.Dir)
+	os.Remove(config.PosFile)
+	config.ExplicitCommit = true
+	tail = tailTest.StartTail("test.txt", config)
+	for i := 0; i < 20; i++ {
+		line := <-tail.Lines
+		if i < 10 {
+			if err := tail.Commit(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	tail.Stop()
+	tail = tailTest.StartTail("test.txt", config)
+	if line := <-tail.Lines; string(line.Text) != "10" {
+		t.Errorf("expected the first line not committed, got %q", line.Text)
+	}
+	tail.Stop()
+	config.ExplicitCommit = false
+
+	// the oldest lines are evicted past MaxSize
+	os.RemoveAll(config.Queue.Dir)
+	os.Remove(config.PosFile)
+	config.Queue.MaxSize = 2048
+	tail = tailTest.StartTail("test.txt", config)
+	<-time.After(100 * time.Millisecond)
+	got = nil
+	var evicted *QueueEvictionError
+	for line := range tail.Lines {
+		if err, ok := line.Err.(*QueueEvictionError); ok {
+			evicted = err
+			continue
+		}
+		got = append(got, string(line.Text))
+	}
+	if evicted == nil || len(got) >= 100 || got[len(got)-1] != "99" {
+		t.Errorf("expected the last lines after an eviction, got %v and %q", evicted, got)
+	}
+	tailTest.Cleanup(tail, false)
+
+	// each file tailed by TailGlob has its own queue
+	os.RemoveAll(config.Queue.Dir)
+	tailTest.CreateFile("test2.txt", "hello\n")
+	m, err := TailGlob(tailTest.path+"/*.txt", Config{Queue: &Queue{Dir: config.Queue.Dir}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range m.Lines {
+		n++
+	}
+	if n != 101 {
+		t.Errorf("expected 101 lines, got %d", n)
+	}
+	for _, name := range []string{"test.txt", "test2.txt"} {
+		dir := filepath.Join(config.Queue.Dir, url.QueryEscape(tailTest.path+"/"+name))
+		if segments, _ := filepath.Glob(dir + "/*.seg"); len(segments) == 0 {
+			t.Errorf("expected the queue of %s in %s", name, dir)
+		}
+	}
+	tailTest.RemoveFile("test2.txt")
+}
+
+func TestStats(t *testing.T) {
+	tailTest := NewTailTest("stats", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	reported := make(chan Stats, 10)
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, Poll: true, Metrics: func(s Stats) { reported <- s }})
+	tailTest.ReadLines(tail, []string{"hello", "world"})
+
+	<-time.After(100 * time.Millisecond)
+	stats := tail.Stats()
+	if stats.LinesRead != 2 || stats.BytesRead != 12 || stats.Offset != 12 || stats.Lag != 0 || stats.LastLine.IsZero() {
+		t.Errorf("expected 2 lines read up to offset 12, got %+v", stats)
+	}
+	tailTest.AppendFile("test.txt", "more\n")
+	tailTest.ReadLines(tail, []string{"more"})
+	tailTest.TruncateFile("test.txt", "again\n")
+	tailTest.ReadLines(tail, []string{"again"})
+
+	tail.Stop()
+	stats = <-reported
+	if stats.LinesRead != 4 || stats.BytesRead != 23 || stats.Offset != 6 || stats.Truncations != 1 || stats.Reopens != 1 {
+		t.Errorf("expected 4 lines read and a truncation, got %+v", stats)
+	}
+	tail.Cleanup()
+}
+
+func TestEvents(t *testing.T) {
+	tailTest := NewTailTest("events", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	events := make(chan Event, 100)
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, ReOpen: true, Events: func(e Event) { events <- e }})
+	tailTest.ReadLines(tail, []string{"hello", "world"})
+
+	<-time.After(100 * time.Millisecond)
+	tailTest.TruncateFile("test.txt", "again\n")
+	tailTest.ReadLines(tail, []string{"again"})
+	<-time.After(100 * time.Millisecond)
+	tailTest.RenameFile("test.txt", "test.txt.1")
+	<-time.After(100 * time.Millisecond)
+	tailTest.CreateFile("test.txt", "new\n")
+	tailTest.ReadLines(tail, []string{"new"})
+	<-time.After(100 * time.Millisecond)
+	tailTest.Cleanup(tail, true)
+	close(events)
+
+	var got []string
+	var offsets []int64
+	for e := range events {
+		if e.Type == WaitingForFile {
+			continue
+		}
+		if n := len(got); n > 0 && got[n-1] == e.Type.String() {
+			// the new file may be found empty first
+			offsets[n-1] = e.Offset
+			continue
+		}
+		got = append(got, e.Type.String())
+		offsets = append(offsets, e.Offset)
+		if e.Filename != tail.Filename || e.Time.IsZero() {
+			t.Errorf("expected an event of %s, got %+v", tail.Filename, e)
+		}
+	}
+	want := []string{
+		"FileOpened", "ReachedEOF",
+		"FileTruncated", "FileOpened", "ReachedEOF",
+		"FileRotated", "FileOpened", "ReachedEOF",
+		"Stopped",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+	if wantOffsets := []int64{0, 12, 12, 0, 6, 6, 0, 4, 4}; !reflect.DeepEqual(offsets, wantOffsets) {
+		t.Errorf("expected offsets %v, got %v", wantOffsets, offsets)
+	}
+}
+
+// recordingLogger records the messages logged, as "LEVEL message".
+type recordingLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordingLogger) record(level, msg string) {
+	l.mu.Lock()
+	l.msgs = append(l.msgs, level+" "+msg)
+	l.mu.Unlock()
+}
+
+func (l *recordingLogger) Debug(msg string, keyvals ...interface{}) { l.record("DEBUG", msg) }
+func (l *recordingLogger) Info(msg string, keyvals ...interface{})  { l.record("INFO", msg) }
+func (l *recordingLogger) Warn(msg string, keyvals ...interface{})  { l.record("WARN", msg) }
+func (l *recordingLogger) Error(msg string, keyvals ...interface{}) { l.record("ERROR", msg) }
+
+func (l *recordingLogger) logged(msg string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, m := range l.msgs {
+		if m == msg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	NewStdLogger(log.New(&buf, "", 0)).Warn("Cannot watch", "dir", "a b", "err", errors.New("failed"), "odd")
+	NewStdLogger(log.New(&buf, "", 0)).Debug("dropped")
+	if want := "WARN Cannot watch dir=\"a b\" err=failed odd=!MISSING\n"; buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+
+	tailTest := NewTailTest("log", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	logger := &recordingLogger{}
+	tail := tailTest.StartTail("test.txt", Config{Follow: true, ReOpen: true, Log: logger})
+	tailTest.ReadLines(tail, []string{"hello"})
+	<-time.After(100 * time.Millisecond)
+	tailTest.RenameFile("test.txt", "test.txt.1")
+	<-time.After(100 * time.Millisecond)
+	tailTest.CreateFile("test.txt", "world\n")
+	tailTest.ReadLines(tail, []string{"world"})
+	tailTest.Cleanup(tail, true)
+
+	for _, msg := range []string{"DEBUG File moved or renamed", "INFO Re-opening moved or deleted file"} {
+		if !logger.logged(msg) {
+			t.Errorf("expected %q to be logged, got %q", msg, logger.msgs)
+		}
+	}
+}
+
 func TestOver4096ByteLine(t *testing.T) {
 	tailTest := NewTailTest("Over4096ByteLine", t)
 	testString := strings.Repeat("a", 4097)
@@ -211,6 +1225,15 @@ func TestLocationMiddle(t *testing.T) {
 	tailTest.Cleanup(tail, true)
 }
 
+func TestLocationBeforeStart(t *testing.T) {
+	// Reading more bytes from the end than the file has reads it whole.
+	tailTest := NewTailTest("location-before-start", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	tail := tailTest.StartTail("test.txt", Config{Location: &SeekInfo{-100, os.SEEK_END}})
+	tailTest.VerifyTailOutput(tail, []string{"hello", "world"}, true)
+	tailTest.RemoveFile("test.txt")
+}
+
 // The use of polling file watcher could affect file rotation
 // (detected via renames), so test these explicitly.
 
@@ -222,6 +1245,45 @@ func TestReOpenPolling(t *testing.T) {
 	reOpen(t, true)
 }
 
+func TestDrainRotatedFile(t *testing.T) {
+	tailTest := NewTailTest("drain-rotated", t)
+	tailTest.CreateFile("test.txt", "hello\n")
+	eof := make(chan struct{}, 1)
+	tail := tailTest.StartTail(
+		"test.txt",
+		Config{Follow: true, ReOpen: true, RotateGrace: 300 * time.Millisecond,
+			Events: func(e Event) {
+				if e.Type == ReachedEOF {
+					select {
+					case eof <- struct{}{}:
+					default:
+					}
+				}
+			}})
+	tailTest.ReadLines(tail, []string{"hello"})
+	// the file is watched once read to its end
+	<-eof
+	<-time.After(100 * time.Millisecond)
+
+	// writes to the rotated file after the new file shows up are read
+	// before switching to the new file
+	tailTest.RenameFile("test.txt", "test.txt.1")
+	tailTest.CreateFile("test.txt", "new\n")
+	<-time.After(100 * time.Millisecond)
+	tailTest.AppendFile("test.txt.1", "late\nunterminated")
+
+	tailTest.ReadLines(tail, []string{"late", "unterminated", "new"})
+	tailTest.Cleanup(tail, true)
+}
+
+func TestTruncateRewriteInotify(t *testing.T) {
+	truncateRewrite(t, false)
+}
+
+func TestTruncateRewritePolling(t *testing.T) {
+	truncateRewrite(t, true)
+}
+
 // The use of polling file watcher could affect file rotation
 // (detected via renames), so test these explicitly.
 
@@ -233,33 +1295,93 @@ func TestReSeekPolling(t *testing.T) {
 	reSeek(t, true)
 }
 
-// func TestRateLimiting(t *testing.T) {
-// 	tailTest := NewTailTest("rate-limiting", t)
-// 	tailTest.CreateFile("test.txt", "hello\nworld\nagain\nextra\n")
-// 	config := Config{
-// 		Follow:      true,
-// 		RateLimiter: ratelimiter.NewLeakyBucket(2, time.Second)}
-// 	leakybucketFull := "Too much log activity; waiting a second before resuming tailing"
-// 	tail := tailTest.StartTail("test.txt", config)
+func TestRateLimitingDrop(t *testing.T) {
+	tailTest := NewTailTest("rate-limiting-drop", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\nagain\nextra\n")
+	config := Config{
+		Follow:          false,
+		RateLimiter:     ratelimiter.NewLeakyBucket(2, time.Hour),
+		RateLimitPolicy: RateLimitDrop}
+	tail := tailTest.StartTail("test.txt", config)
+	dropped := (&RateLimitError{Dropped: 2}).Error()
+	tailTest.VerifyTailOutput(tail, []string{"hello", "world", dropped}, true)
+	tailTest.Cleanup(tail, false)
+}
 
-// 	// TODO: also verify that tail resumes after the cooloff period.
-// 	go tailTest.VerifyTailOutput(tail, []string{
-// 		"hello", "world", "again",
-// 		leakybucketFull,
-// 		"more", "data",
-// 		leakybucketFull}, false)
+func TestRateLimitingBlock(t *testing.T) {
+	tailTest := NewTailTest("rate-limiting-block", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\nagain\n")
+	config := Config{
+		Follow:      false,
+		RateLimiter: ratelimiter.NewLeakyBucket(2, 50*time.Millisecond)}
+	then := time.Now()
+	tail := tailTest.StartTail("test.txt", config)
+	tailTest.VerifyTailOutput(tail, []string{"hello", "world", "again"}, true)
+	if elapsed := time.Since(then); elapsed < 50*time.Millisecond {
+		t.Errorf("rate limiter did not block (%s)", elapsed)
+	}
+	tailTest.Cleanup(tail, false)
+}
 
-// 	// Add more data only after reasonable delay.
-// 	<-time.After(1200 * time.Millisecond)
-// 	tailTest.AppendFile("test.txt", "more\ndata\n")
+func TestRateLimitingStopped(t *testing.T) {
+	tailTest := NewTailTest("rate-limiting-stopped", t)
+	tailTest.CreateFile("test.txt", "1\n2\n3\n")
+	for _, explicit := range []bool{false, true} {
+		config := Config{
+			PosFile:        tailTest.path + "/test.pos",
+			ExplicitCommit: explicit,
+			RateLimiter:    ratelimiter.NewLeakyBucket(1, time.Hour)}
+		os.Remove(config.PosFile)
+		tail := tailTest.StartTail("test.txt", config)
+		if err := tail.Commit(<-tail.Lines); explicit && err != nil {
+			t.Fatal(err)
+		}
+		// the line blocked on when stopped is read again on resume
+		<-time.After(100 * time.Millisecond)
+		tail.Stop()
 
-// 	// Delete after a reasonable delay, to give tail sufficient time
-// 	// to read all lines.
-// 	<-time.After(100 * time.Millisecond)
-// 	tailTest.RemoveFile("test.txt")
+		config.RateLimiter = nil
+		tail = tailTest.StartTail("test.txt", config)
+		tailTest.ReadLines(tail, []string{"2", "3"})
+		tail.Stop()
+	}
+	tailTest.RemoveFile("test.txt")
+}
+
+func TestRateLimitingCoolOff(t *testing.T) {
+	tailTest := NewTailTest("rate-limiting-cooloff", t)
+	tailTest.CreateFile("test.txt", "hello\nworld\nagain\nextra\n")
+	config := Config{
+		Follow:          true,
+		RateLimiter:     ratelimiter.NewLeakyBucket(2, 100*time.Millisecond),
+		RateLimitPolicy: RateLimitCoolOff}
+	tail := tailTest.StartTail("test.txt", config)
+	tailTest.ReadLines(tail, []string{"hello", "world"})
 
-// 	tailTest.Cleanup(tail, true)
-// }
+	line := <-tail.Lines
+	err, ok := line.Err.(*RateLimitError)
+	if !ok || err.CoolOff <= 0 {
+		t.Fatalf("expected a cool-off RateLimitError, got %q", line.Text)
+	}
+	then := time.Now()
+	// written while cooling off, and skipped
+	tailTest.AppendFile("test.txt", "during\n")
+
+	<-time.After(err.CoolOff + 100*time.Millisecond)
+	tailTest.AppendFile("test.txt", "after\n")
+	select {
+	case line := <-tail.Lines:
+		if string(line.Text) != "after" {
+			t.Errorf("expected reading to resume with after, got %q", line.Text)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reading did not resume after cooling off")
+	}
+	if elapsed := time.Since(then); elapsed < err.CoolOff {
+		t.Errorf("reading resumed after %s, before the %s cool-off", elapsed, err.CoolOff)
+	}
+	tailTest.Cleanup(tail, true)
+}
 
 func TestTell(t *testing.T) {
 	tailTest := NewTailTest("tell-position", t)
@@ -284,7 +1406,7 @@ func TestTell(t *testing.T) {
 	for l := range tail.Lines {
 		// it may readed one line in the chan(tail.Lines),
 		// so it may lost one line.
-		if l.Text != "world" && l.Text != "again" {
+		if string(l.Text) != "world" && string(l.Text) != "again" {
 			tailTest.Fatalf("mismatch; expected world or again, but got %s",
 				l.Text)
 		}
@@ -295,6 +1417,36 @@ func TestTell(t *testing.T) {
 	tail.Cleanup()
 }
 
+func TestLineMetadata(t *testing.T) {
+	tailTest := NewTailTest("line-metadata", t)
+	tailTest.CreateFile("test.txt", "hello\r\nworld\n")
+	before := time.Now()
+	tail := tailTest.StartTail("test.txt", Config{Follow: false})
+
+	expected := []struct {
+		text        string
+		offset, end int64
+	}{{"hello", 0, 7}, {"world", 7, 13}}
+	for i, e := range expected {
+		line := <-tail.Lines
+		if string(line.Text) != e.text || line.Offset != e.offset || line.EndOffset != e.end {
+			t.Fatalf("expected %q at [%d,%d), got %q at [%d,%d)",
+				e.text, e.offset, e.end, line.Text, line.Offset, line.EndOffset)
+		}
+		if line.Num != uint64(i+1) {
+			t.Errorf("expected line number %d, got %d", i+1, line.Num)
+		}
+		if line.Filename != tail.Filename || line.FileID != tail.id {
+			t.Errorf("unexpected source %s %+v", line.Filename, line.FileID)
+		}
+		if line.Time.Before(before) {
+			t.Errorf("read time %v is before tail started", line.Time)
+		}
+	}
+	tail.Wait()
+	tail.Cleanup()
+}
+
 func TestBlockUntilExists(t *testing.T) {
 	tailTest := NewTailTest("block-until-file-exists", t)
 	config := Config{
@@ -306,7 +1458,7 @@ func TestBlockUntilExists(t *testing.T) {
 		tailTest.CreateFile("test.txt", "hello world\n")
 	}()
 	for l := range tail.Lines {
-		if l.Text != "hello world" {
+		if string(l.Text) != "hello world" {
 			tailTest.Fatalf("mismatch; expected hello world, but got %s",
 				l.Text)
 		}
@@ -317,6 +1469,55 @@ func TestBlockUntilExists(t *testing.T) {
 	tail.Cleanup()
 }
 
+func TestTailGlobInotify(t *testing.T) {
+	tailGlob(t, false)
+}
+
+func TestTailGlobPolling(t *testing.T) {
+	tailGlob(t, true)
+}
+
+func TestTailGlobCommit(t *testing.T) {
+	name := "glob-commit"
+	os.RemoveAll(".test/" + name)
+	defer os.RemoveAll(".test/" + name)
+	tailTest := NewTailTest(name, t)
+	tailTest.CreateFile("a.log", "hello\n")
+	m, err := TailGlob(tailTest.path+"/*.log", Config{
+		Follow:         true,
+		PosFile:        tailTest.path + "/pos",
+		ExplicitCommit: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := func() *Line {
+		select {
+		case line := <-m.Lines:
+			return line
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a line")
+			return nil
+		}
+	}
+	old := next()
+
+	tailTest.RemoveFile("a.log")
+	<-time.After(100 * time.Millisecond)
+	tailTest.CreateFile("a.log", "again\n")
+	line := next()
+	if string(line.Text) != "again" {
+		t.Fatalf("expected again, got %q", line.Text)
+	}
+	// the line of the removed file does not commit that of the new one
+	if err := m.Commit(old); err != ErrNotPending {
+		t.Errorf("expected ErrNotPending committing a line of the removed file, got %v", err)
+	}
+	if err := m.Commit(line); err != nil {
+		t.Error(err)
+	}
+	m.Stop()
+}
+
 func maxLineSize(t *testing.T, follow bool, fileContent string, expected []string) {
 	tailTest := NewTailTest("maxlinesize", t)
 	tailTest.CreateFile("test.txt", fileContent)
@@ -372,6 +1573,65 @@ func reOpen(t *testing.T, poll bool) {
 	tail.Cleanup()
 }
 
+func tailGlob(t *testing.T, poll bool) {
+	name := "glob-inotify"
+	if poll {
+		name = "glob-polling"
+	}
+	// files left by a previous run would be tailed too
+	os.RemoveAll(".test/" + name)
+	defer os.RemoveAll(".test/" + name)
+	tailTest := NewTailTest(name, t)
+	tailTest.CreateFile("a.log", "hello\n")
+	tailTest.CreateFile("c.txt", "ignored\n")
+	m, err := TailGlob(tailTest.path+"/*.log", Config{Follow: true, Poll: poll})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lines of different files may come in any order
+	expect := func(want map[string][]string) {
+		n := 0
+		for _, lines := range want {
+			n += len(lines)
+		}
+		got := make(map[string][]string)
+		for ; n > 0; n-- {
+			select {
+			case line := <-m.Lines:
+				if filepath.Dir(line.Filename) != tailTest.path {
+					t.Fatalf("expected a file of %s, got %q from %s", tailTest.path, line.Text, line.Filename)
+				}
+				filename := filepath.Base(line.Filename)
+				got[filename] = append(got[filename], string(line.Text))
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %v, got %v", want, got)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+	expect(map[string][]string{"a.log": {"hello"}})
+
+	<-time.After(100 * time.Millisecond)
+	tailTest.CreateFile("b.log", "world\n")
+	tailTest.AppendFile("a.log", "more\n")
+	expect(map[string][]string{"a.log": {"more"}, "b.log": {"world"}})
+
+	tailTest.RemoveFile("a.log")
+	<-time.After(100 * time.Millisecond)
+	tailTest.CreateFile("a.log", "again\n")
+	expect(map[string][]string{"a.log": {"again"}})
+
+	if err := m.Stop(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-m.Lines; ok {
+		t.Error("Lines is not closed after Stop")
+	}
+}
+
 func reSeek(t *testing.T, poll bool) {
 	var name string
 	if poll {
@@ -403,6 +1663,93 @@ func reSeek(t *testing.T, poll bool) {
 	tailTest.Cleanup(tail, false)
 }
 
+// truncateRewrite checks that a file truncated and written again past
+// the read position is read again from its start.
+func truncateRewrite(t *testing.T, poll bool) {
+	var name string
+	if poll {
+		name = "truncate-rewrite-polling"
+	} else {
+		name = "truncate-rewrite-inotify"
+	}
+	tailTest := NewTailTest(name, t)
+	tailTest.CreateFile("test.txt", "hello\nworld\n")
+	tail := tailTest.StartTail(
+		"test.txt",
+		Config{Follow: true, Poll: poll, TruncateMarker: true})
+	tailTest.ReadLines(tail, []string{"hello", "world"})
+
+	<-time.After(100 * time.Millisecond)
+	tailTest.TruncateFile("test.txt", "a much longer line\nmore\n")
+
+	line := <-tail.Lines
+	if err, ok := line.Err.(*TruncationError); !ok || err.Offset != 12 {
+		t.Fatalf("expected a TruncationError at offset 12, got %v", line.Err)
+	}
+	tailTest.ReadLines(tail, []string{"a much longer line", "more"})
+	tailTest.Cleanup(tail, true)
+}
+
+// benchmarkFile creates a file of n lines for a benchmark.
+func benchmarkFile(b *testing.B, n int) string {
+	dir := ".test/benchmark"
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		b.Fatal(err)
+	}
+	name := dir + "/test.txt"
+	f, err := os.Create(name)
+	if err != nil {
+		b.Fatal(err)
+	}
+	w := bufio.NewWriter(f)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(w, "2026-10-17T00:00:00Z level=info msg=\"line %d\"\n", i)
+	}
+	if err := w.Flush(); err != nil {
+		b.Fatal(err)
+	}
+	f.Close()
+	return name
+}
+
+func BenchmarkTailFile(b *testing.B) {
+	name := benchmarkFile(b, b.N)
+	defer os.Remove(name)
+	b.ResetTimer()
+
+	tail, err := TailFile(name, Config{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	n := 0
+	for range tail.Lines {
+		n++
+	}
+	if err := tail.Wait(); err != nil || n != b.N {
+		b.Fatalf("read %d of %d lines: %v", n, b.N, err)
+	}
+}
+
+func BenchmarkTailFileBatches(b *testing.B) {
+	name := benchmarkFile(b, b.N)
+	defer os.Remove(name)
+	b.ResetTimer()
+
+	n := 0
+	tail, err := TailFileBatches(name, Config{}, Batch{}, func(lines []*Line) error {
+		n += len(lines)
+		return nil
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for range tail.Lines {
+	}
+	if err := tail.Wait(); err != nil || n != b.N {
+		b.Fatalf("read %d of %d lines: %v", n, b.N, err)
+	}
+}
+
 // Test library
 
 type TailTest struct {
@@ -506,7 +1853,7 @@ func (t TailTest) ReadLines(tail *Tail, lines []string) {
 		}
 		// Note: not checking .Err as the `lines` argument is designed
 		// to match error strings as well.
-		if tailedLine.Text != line {
+		if string(tailedLine.Text) != line {
 			t.Fatalf(
 				"unexpected line/err from tail: "+
 					"expecting <<%s>>>, but got <<<%s>>>",
@@ -3,10 +3,16 @@
 package tail
 
 import (
-	"github.com/hpcloud/tail/winfile"
+	"github.com/pavamana1123/tail/winfile"
 	"os"
 )
 
 func OpenFile(name string) (file *os.File, err error) {
 	return winfile.OpenFile(name, os.O_RDONLY, 0)
 }
+
+// fileIDOf returns the zero FileID; file identity is not tracked on
+// Windows, so checkpoints are validated against the file size only.
+func fileIDOf(fi os.FileInfo) FileID {
+	return FileID{}
+}
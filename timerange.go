@@ -0,0 +1,239 @@
+package tail
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrTimeRangeWithSplit is returned by TailFile when Config.TimeRange has
+// a Since time along with Config.Split, which cannot be used to search
+// lines.
+var ErrTimeRangeWithSplit = errors.New("tail: cannot set TimeRange.Since with Split")
+
+// TimeRange selects lines by the time they were logged, parsed from their
+// text. Lines without a timestamp, such as the continuation lines of stack
+// traces, go with the lines before them.
+type TimeRange struct {
+	Since time.Time // Start at the first line logged at or after Since (zero: Config.Location)
+	Until time.Time // Stop before the first line logged after Until (zero: no limit)
+
+	// Layout is the layout of the timestamps, as taken by time.Parse
+	// (default: time.RFC3339). Layouts without a year are taken in the
+	// current year.
+	Layout string
+
+	// Pattern, if set, extracts the timestamp from the line: its first
+	// submatch, or the whole match. Otherwise, the timestamp is the first
+	// fields of the line, as many as in Layout.
+	Pattern *regexp.Regexp
+
+	// Location is the time zone of timestamps without one (default: time.Local)
+	Location *time.Location
+}
+
+// timestamp returns the time a line was logged at, if it has one.
+func (r *TimeRange) timestamp(text []byte) (time.Time, bool) {
+	layout := r.Layout
+	if layout == "" {
+		layout = time.RFC3339
+	}
+
+	var value string
+	if r.Pattern != nil {
+		m := r.Pattern.FindSubmatch(text)
+		if m == nil {
+			return time.Time{}, false
+		}
+		if len(m) > 1 {
+			value = string(m[1])
+		} else {
+			value = string(m[0])
+		}
+	} else {
+		// compare fields, which ignores padding
+		fields := strings.Fields(layout)
+		if len(text) > 256 {
+			text = text[:256]
+		}
+		values := bytes.Fields(text)
+		if len(values) < len(fields) {
+			return time.Time{}, false
+		}
+		layout = strings.Join(fields, " ")
+		value = string(bytes.Join(values[:len(fields)], []byte{' '}))
+	}
+
+	loc := r.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if t.Year() == 0 {
+		t = t.AddDate(time.Now().Year(), 0, 0)
+	}
+	return t, true
+}
+
+// timestamp returns the time a line read from the file was logged at.
+func (tail *Tail) timestamp(text []byte) (time.Time, bool) {
+	if tail.encoding != nil && tail.encoding.decode != nil {
+		if decoded, err := tail.encoding.decode(text); err == nil {
+			text = decoded
+		}
+	}
+	return tail.TimeRange.timestamp(text)
+}
+
+// sinceOffset returns the offset of the first line logged at or after
+// TimeRange.Since in the input, which is positioned at its start. Files
+// are binary searched, down to regions of a block which are scanned; the
+// input is left positioned anywhere.
+func (tail *Tail) sinceOffset() (int64, error) {
+	tail.detectEncoding()
+	input := tail.input()
+	start, err := input.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return 0, err
+	}
+	if tail.decompressed != nil {
+		return tail.scanSince(input, start)
+	}
+
+	fi, err := tail.File.Stat()
+	if err != nil {
+		return 0, err
+	}
+	// lines before lo were logged before Since; the line sought starts at
+	// or before hi, unless lines between are unparseable
+	lo, hi := start, fi.Size()
+	unit := int64(tail.unit())
+	for hi-lo > lineBlockSize {
+		mid := lo + (hi-lo)/2
+		mid -= mid % unit
+
+		lines := tail.newLineScanner(io.NewSectionReader(tail.File, mid, hi-mid), mid)
+		lines.next() // partial line
+		found := false
+		for lines.offset < hi {
+			start := lines.offset
+			text, end, err := lines.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, err
+			}
+			if t, ok := tail.timestamp(text); ok {
+				if t.Before(tail.TimeRange.Since) {
+					lo = end
+				} else {
+					hi = start
+				}
+				found = true
+				break
+			}
+		}
+		if !found {
+			// no timestamps: narrow down the region to scan
+			hi = mid
+		}
+	}
+	return tail.scanSince(io.NewSectionReader(tail.File, lo, math.MaxInt64-lo), lo)
+}
+
+// scanSince returns the offset of the first line logged at or after
+// TimeRange.Since in r, which is positioned at offset, or the offset of
+// its end.
+func (tail *Tail) scanSince(r io.Reader, offset int64) (int64, error) {
+	lines := tail.newLineScanner(r, offset)
+	for {
+		start := lines.offset
+		text, _, err := lines.next()
+		if err == io.EOF {
+			return start, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if t, ok := tail.timestamp(text); ok && !t.Before(tail.TimeRange.Since) {
+			return start, nil
+		}
+	}
+}
+
+// pastUntil reports whether l, or a line sent before, was logged after
+// TimeRange.Until.
+func (tail *Tail) pastUntil(l *Line) bool {
+	r := tail.TimeRange
+	if !tail.untilReached && r != nil && !r.Until.IsZero() && tail.part == 0 {
+		t, ok := r.timestamp(l.Text)
+		tail.untilReached = ok && t.After(r.Until)
+	}
+	return tail.untilReached
+}
+
+// lineScanner reads the lines of the input to find their timestamps.
+type lineScanner struct {
+	r      *bufio.Reader
+	delim  []byte
+	unit   int64
+	offset int64 // of the next line
+}
+
+func (tail *Tail) newLineScanner(r io.Reader, offset int64) *lineScanner {
+	delim, _ := tail.delimiter()
+	return &lineScanner{
+		r:      bufio.NewReaderSize(r, lineBlockSize),
+		delim:  delim,
+		unit:   int64(tail.unit()),
+		offset: offset,
+	}
+}
+
+// next returns the start of the next line, up to lineBlockSize bytes of
+// it, and the offset following the line. It returns io.EOF when there are
+// no lines left.
+func (s *lineScanner) next() (text []byte, end int64, err error) {
+	d := len(s.delim)
+	start := s.offset
+	var last []byte // the last bytes read, to match the delimiter on
+	for {
+		chunk, err := s.r.ReadSlice(s.delim[d-1])
+		s.offset += int64(len(chunk))
+		if len(text) < lineBlockSize {
+			text = append(text, chunk...)
+		}
+		if len(chunk) > d {
+			chunk = chunk[len(chunk)-d:]
+		}
+		last = append(last, chunk...)
+		if len(last) > d {
+			last = last[len(last)-d:]
+		}
+
+		switch {
+		case err == nil && bytes.Equal(last, s.delim) && (s.offset-int64(d))%s.unit == 0:
+			if int64(len(text)) == s.offset-start {
+				text = text[:len(text)-d]
+			}
+			return text, s.offset, nil
+		case err == io.EOF:
+			if s.offset > start {
+				return text, s.offset, nil
+			}
+			return nil, s.offset, io.EOF
+		case err != nil && err != bufio.ErrBufferFull:
+			return nil, s.offset, err
+		}
+	}
+}
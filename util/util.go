@@ -17,6 +17,8 @@ type Logger struct {
 var LOGGER = &Logger{log.New(os.Stderr, "", log.LstdFlags)}
 
 // fatal is like panic except it displays only the current goroutine's stack.
+//
+// Deprecated: the tail packages report errors instead of exiting.
 func Fatal(format string, v ...interface{}) {
 	// https://github.com/hpcloud/log/blob/master/log.go#L45
 	LOGGER.Output(2, fmt.Sprintf("FATAL -- "+format, v...)+"\n"+string(debug.Stack()))
@@ -46,3 +48,24 @@ func PartitionString(s string, chunkSize int) []string {
 	}
 	return parts
 }
+
+// WriteFileAtomic writes data to a temporary file next to filename and
+// renames it into place, so readers never observe a partially written file.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp := filename + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
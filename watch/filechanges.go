@@ -1,15 +1,28 @@
 package watch
 
+import (
+	"os"
+	"sync/atomic"
+)
+
 type FileChanges struct {
-	Modified       chan bool // Channel to get notified of modifications
-	Truncated      chan bool // Channel to get notified of truncations
-	Deleted        chan bool // Channel to get notified of deletions/renames
-	SymLinkChanged chan bool // Channel to get notified of symlink changes
+	Modified       chan bool  // Channel to get notified of modifications
+	Truncated      chan bool  // Channel to get notified of truncations
+	Deleted        chan bool  // Channel to get notified of deletions/renames
+	SymLinkChanged chan bool  // Channel to get notified of symlink changes
+	Error          chan error // Channel to get notified of the error that stopped the watcher
+
+	truncatedFrom int64 // size of the file before the last truncation
 }
 
 func NewFileChanges() *FileChanges {
 	return &FileChanges{
-		make(chan bool), make(chan bool), make(chan bool), make(chan bool)}
+		Modified:       make(chan bool),
+		Truncated:      make(chan bool),
+		Deleted:        make(chan bool),
+		SymLinkChanged: make(chan bool),
+		Error:          make(chan error, 1),
+	}
 }
 
 func (fc *FileChanges) NotifyModified() {
@@ -20,6 +33,19 @@ func (fc *FileChanges) NotifyTruncated() {
 	sendOnlyIfEmpty(fc.Truncated)
 }
 
+// NotifyTruncatedFrom notifies of a truncation of the file, which was
+// size bytes long before.
+func (fc *FileChanges) NotifyTruncatedFrom(size int64) {
+	atomic.StoreInt64(&fc.truncatedFrom, size)
+	fc.NotifyTruncated()
+}
+
+// TruncatedFrom returns the size of the file before the last truncation
+// notified by NotifyTruncatedFrom.
+func (fc *FileChanges) TruncatedFrom() int64 {
+	return atomic.LoadInt64(&fc.truncatedFrom)
+}
+
 func (fc *FileChanges) NotifyDeleted() {
 	sendOnlyIfEmpty(fc.Deleted)
 }
@@ -28,6 +54,40 @@ func (fc *FileChanges) NotifySymLinkChanged() {
 	sendOnlyIfEmpty(fc.SymLinkChanged)
 }
 
+// notifyReplaced reports the file as deleted, or as a symlink retargeted,
+// once the changes are received, as ChangeEvents returns before they are.
+func (fc *FileChanges) notifyReplaced(done <-chan struct{}, symlink bool) {
+	ch := fc.Deleted
+	if symlink {
+		ch = fc.SymLinkChanged
+	}
+	select {
+	case ch <- true:
+	case <-done:
+	}
+}
+
+// replaced reports whether the file opened, if known, is no longer the one
+// at its name, stat with fi and err.
+func replaced(opened, fi os.FileInfo, err error) bool {
+	if opened == nil {
+		return false
+	}
+	if err != nil {
+		return os.IsNotExist(err)
+	}
+	return !os.SameFile(opened, fi)
+}
+
+// NotifyError reports the error that stopped the watcher. Only the first
+// error is kept.
+func (fc *FileChanges) NotifyError(err error) {
+	select {
+	case fc.Error <- err:
+	default:
+	}
+}
+
 // sendOnlyIfEmpty sends on a bool channel only if the channel has no
 // backlog to be read by other goroutines. This concurrency pattern
 // can be used to notify other goroutines if and only if they are
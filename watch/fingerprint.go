@@ -0,0 +1,80 @@
+package watch
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// FingerprintInterval is the least time between two checks of the
+// fingerprint of a file, which read its first bytes, so that they are not
+// read on every write. A file rewritten within the interval is found out
+// once it has passed.
+var FingerprintInterval = 100 * time.Millisecond
+
+// fingerprint records the first bytes of a file, which tells a file that
+// was truncated and written again past its previous size apart from one
+// that merely grew.
+type fingerprint struct {
+	size    int       // number of bytes to record; disabled if <= 0
+	prefix  []byte    // first bytes of the file, up to size
+	checked time.Time // when the file was last compared with prefix
+}
+
+func newFingerprint(filename string, size int) *fingerprint {
+	fp := &fingerprint{size: size}
+	fp.reset(filename)
+	return fp
+}
+
+// reset records the current first bytes of the file.
+func (fp *fingerprint) reset(filename string) {
+	if fp.size <= 0 {
+		return
+	}
+	fp.prefix, _ = readPrefix(filename, fp.size)
+}
+
+// wait returns how long until the fingerprint may be checked again, or
+// zero or less if it may be now.
+func (fp *fingerprint) wait() time.Duration {
+	if fp.size <= 0 {
+		return 0
+	}
+	return fp.checked.Add(FingerprintInterval).Sub(time.Now())
+}
+
+// changed reports whether the file no longer starts with the recorded
+// bytes. The record is extended as the file grows.
+func (fp *fingerprint) changed(filename string) bool {
+	if fp.size <= 0 {
+		return false
+	}
+	prefix, err := readPrefix(filename, fp.size)
+	fp.checked = time.Now()
+	if err != nil {
+		return false
+	}
+	if len(prefix) < len(fp.prefix) || !bytes.Equal(prefix[:len(fp.prefix)], fp.prefix) {
+		return true
+	}
+	fp.prefix = prefix
+	return false
+}
+
+// readPrefix returns the first n bytes of the file, or all of it if shorter.
+func readPrefix(filename string, n int) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	buf := make([]byte, n)
+	m, err := io.ReadFull(f, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	return buf[:m], err
+}
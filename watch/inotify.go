@@ -4,9 +4,9 @@
 package watch
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
@@ -15,7 +15,6 @@ import (
 
 	"strings"
 
-	"github.com/pavamana1123/tail/util"
 	"gopkg.in/fsnotify.v1"
 	"gopkg.in/tomb.v1"
 )
@@ -24,6 +23,18 @@ import (
 type InotifyFileWatcher struct {
 	Filename string
 	Size     int64
+
+	// FingerprintSize is the number of bytes at the start of the file
+	// compared on changes, to detect the file being truncated and written
+	// again past its previous size. Disabled if zero.
+	FingerprintSize int
+
+	// Opened, if set, describes the file open at Filename. ChangeEvents
+	// reports it moved or deleted right away if Filename is another file,
+	// or none, by the time changes are watched.
+	Opened os.FileInfo
+
+	Logger Logger // (default: DefaultLogger)
 }
 
 var (
@@ -36,14 +47,26 @@ func init() {
 }
 
 func NewInotifyFileWatcher(filename string) *InotifyFileWatcher {
-	fw := &InotifyFileWatcher{filepath.Clean(filename), 0}
+	fw := &InotifyFileWatcher{Filename: filepath.Clean(filename)}
 	return fw
 }
 
+func (fw *InotifyFileWatcher) logger() Logger {
+	return loggerOr(fw.Logger)
+}
+
 func (fw *InotifyFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
-	err := WatchCreate(fw.Filename)
+	return tombErr(fw.blockUntilExists(t.Dying()))
+}
+
+func (fw *InotifyFileWatcher) BlockUntilExistsContext(ctx context.Context) error {
+	return contextErr(ctx, fw.blockUntilExists(ctx.Done()))
+}
+
+func (fw *InotifyFileWatcher) blockUntilExists(done <-chan struct{}) error {
+	err := watch(&watchInfo{op: fsnotify.Create, fname: fw.Filename, logger: fw.Logger})
 	if err != nil {
-		log.Println("WatchCreate", err)
+		fw.logger().Error("Unable to watch for the creation of file", "file", fw.Filename, "err", err)
 		return err
 	}
 
@@ -53,7 +76,7 @@ func (fw *InotifyFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
 	// calling `WatchFlags` above.
 	if _, err = os.Stat(fw.Filename); err != nil && !os.IsNotExist(err) {
 		// file exists, or stat returned an error.
-		log.Println("File exists, or stat returned an error.", err)
+		fw.logger().Error("Unable to stat file", "file", fw.Filename, "err", err)
 		return err
 	}
 
@@ -76,16 +99,34 @@ func (fw *InotifyFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
 			if evtName == fwFilename {
 				return nil
 			}
-		case <-t.Dying():
-			return tomb.ErrDying
+		case <-done:
+			return errDone
 		}
 	}
 	panic("unreachable")
 }
 
 func (fw *InotifyFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChanges, error) {
+	return fw.changeEvents(t.Dying(), pos)
+}
+
+func (fw *InotifyFileWatcher) ChangeEventsContext(ctx context.Context, pos int64) (*FileChanges, error) {
+	return fw.changeEvents(ctx.Done(), pos)
+}
 
-	err := Watch(fw.Filename)
+func (fw *InotifyFileWatcher) changeEvents(done <-chan struct{}, pos int64) (*FileChanges, error) {
+	origFi, err := os.Stat(fw.Filename)
+	if replaced(fw.Opened, origFi, err) {
+		lfi, err := os.Lstat(fw.Filename)
+		changes := NewFileChanges()
+		go changes.notifyReplaced(done, err == nil && lfi.Mode()&os.ModeSymlink != 0)
+		return changes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = watch(&watchInfo{fname: fw.Filename, logger: fw.Logger})
 	if err != nil {
 		return nil, err
 	}
@@ -93,11 +134,11 @@ func (fw *InotifyFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChange
 	changes := NewFileChanges()
 	fw.Size = pos
 
-	go changes.detectInotifyChanges(t, fw)
+	go changes.detectInotifyChanges(done, fw, origFi)
 	return changes, nil
 }
 
-func (changes *FileChanges) detectInotifyChanges(t *tomb.Tomb, fw *InotifyFileWatcher) {
+func (changes *FileChanges) detectInotifyChanges(done <-chan struct{}, fw *InotifyFileWatcher, origFi os.FileInfo) {
 
 	var (
 		evt       fsnotify.Event
@@ -112,15 +153,19 @@ func (changes *FileChanges) detectInotifyChanges(t *tomb.Tomb, fw *InotifyFileWa
 	}()
 
 	events := Events(fw.Filename)
+	fp := newFingerprint(fw.Filename, fw.FingerprintSize)
+	lfi, err := os.Lstat(fw.Filename)
+	isSymlink := err == nil && lfi.Mode()&os.ModeSymlink != 0
 
-	symlinkChange, err := changes.detectSymlinkChanges(t, fw)
+	symlinkChange, err := changes.detectSymlinkChanges(done, fw)
 	if err != nil {
 		// error occurs only if path is not a symlink
 		if err == notSymLink {
-			log.Println(err.Error(), ":", fw.Filename)
+			fw.logger().Debug("Not a symlink", "file", fw.Filename)
 		}
 	}
 
+	var recheck <-chan time.Time // a check of the fingerprint put off
 	for {
 		prevSize := fw.Size
 
@@ -130,16 +175,23 @@ func (changes *FileChanges) detectInotifyChanges(t *tomb.Tomb, fw *InotifyFileWa
 				return
 			}
 			break
+		case <-recheck:
+			recheck = nil
+			if fp.changed(fw.Filename) {
+				changes.NotifyTruncatedFrom(prevSize)
+				fp.reset(fw.Filename)
+			}
+			continue
 		case <-symlinkChange:
 			symCh = true
 			return
-		case <-t.Dying():
+		case <-done:
 			return
 		}
 
 		switch {
 		case evt.Op&fsnotify.Remove == fsnotify.Remove:
-			log.Println("File", fw.Filename, "deleted")
+			fw.logger().Debug("File deleted", "file", fw.Filename)
 			fallthrough
 
 		// // it was seen that fsnotify package is returning Chmod event for file delete
@@ -147,7 +199,7 @@ func (changes *FileChanges) detectInotifyChanges(t *tomb.Tomb, fw *InotifyFileWa
 		// 	fallthrough
 
 		case evt.Op&fsnotify.Rename == fsnotify.Rename:
-			log.Println("File ", fw.Filename, "moved/renamed")
+			fw.logger().Debug("File moved or renamed", "file", fw.Filename)
 			changes.NotifyDeleted()
 			return
 
@@ -158,13 +210,32 @@ func (changes *FileChanges) detectInotifyChanges(t *tomb.Tomb, fw *InotifyFileWa
 					changes.NotifyDeleted()
 					return
 				}
-				// XXX: report this error back to the user
-				util.Fatal("Failed to stat file %v: %v", fw.Filename, err)
+				changes.NotifyError(&Error{Op: "stat", Filename: fw.Filename, Err: err})
+				return
+			}
+
+			// File got replaced under its name?
+			if !os.SameFile(origFi, fi) {
+				if isSymlink {
+					symCh = true
+				} else {
+					changes.NotifyDeleted()
+				}
+				return
 			}
 			fw.Size = fi.Size()
 
-			if prevSize > 0 && prevSize > fw.Size {
-				changes.NotifyTruncated()
+			truncated := prevSize > 0 && prevSize > fw.Size
+			if !truncated {
+				if wait := fp.wait(); wait <= 0 {
+					truncated = fp.changed(fw.Filename)
+				} else if recheck == nil {
+					recheck = time.After(wait)
+				}
+			}
+			if truncated {
+				changes.NotifyTruncatedFrom(prevSize)
+				fp.reset(fw.Filename)
 			} else {
 				changes.NotifyModified()
 			}
@@ -174,11 +245,11 @@ func (changes *FileChanges) detectInotifyChanges(t *tomb.Tomb, fw *InotifyFileWa
 	}
 }
 
-func (changes *FileChanges) detectSymlinkChanges(t *tomb.Tomb, fw *InotifyFileWatcher) (chan struct{}, error) {
+func (changes *FileChanges) detectSymlinkChanges(done <-chan struct{}, fw *InotifyFileWatcher) (chan struct{}, error) {
 
 	symLinkChanged := make(chan struct{})
 
-	isSymLink, symlinkPath := getSymlinkPath(fw.Filename)
+	isSymLink, symlinkPath := getSymlinkPath(fw.Filename, fw.logger())
 
 	if !isSymLink {
 		return symLinkChanged, notSymLink
@@ -187,17 +258,19 @@ func (changes *FileChanges) detectSymlinkChanges(t *tomb.Tomb, fw *InotifyFileWa
 retry:
 	target, err := getInode(symlinkPath)
 	if err != nil {
-		NewInotifyFileWatcher(symlinkPath).BlockUntilExists(t)
+		if fw.watcherOf(symlinkPath).blockUntilExists(done) == errDone {
+			return symLinkChanged, errDone
+		}
 		goto retry
 	}
 
-	go changes.pollSymlinkForChange(t, symLinkChanged, symlinkPath, target)
+	go changes.pollSymlinkForChange(done, symLinkChanged, fw.watcherOf(symlinkPath), target)
 
 	return symLinkChanged, nil
 
 }
 
-func (changes *FileChanges) pollSymlinkForChange(t *tomb.Tomb, symLinkChanged chan struct{}, symlinkPath string, targetOld uint64) {
+func (changes *FileChanges) pollSymlinkForChange(done <-chan struct{}, symLinkChanged chan struct{}, link *InotifyFileWatcher, targetOld uint64) {
 
 	var (
 		target uint64
@@ -206,16 +279,19 @@ func (changes *FileChanges) pollSymlinkForChange(t *tomb.Tomb, symLinkChanged ch
 
 	for {
 		select {
-		case <-t.Dying():
+		case <-done:
 			return
 		default:
-			target, err = getInode(symlinkPath)
+			target, err = getInode(link.Filename)
 			if err != nil {
-				NewInotifyFileWatcher(symlinkPath).BlockUntilExists(t)
+				link.blockUntilExists(done)
 				continue
 			}
 			if target != targetOld {
-				symLinkChanged <- struct{}{}
+				select {
+				case symLinkChanged <- struct{}{}:
+				case <-done:
+				}
 				return
 			}
 
@@ -224,7 +300,7 @@ func (changes *FileChanges) pollSymlinkForChange(t *tomb.Tomb, symLinkChanged ch
 	}
 }
 
-func getSymlinkPath(path string) (bool, string) {
+func getSymlinkPath(path string, logger Logger) (bool, string) {
 	dirs := strings.Split(path, "/")
 	depth := len(dirs)
 
@@ -234,7 +310,7 @@ func getSymlinkPath(path string) (bool, string) {
 
 		fileInfo, err := os.Lstat(tpath)
 		if err != nil {
-			log.Println("Error: Unable to open filepath: ", tpath, err.Error())
+			logger.Debug("Unable to stat path", "path", tpath, "err", err)
 			continue
 		}
 
@@ -247,6 +323,13 @@ func getSymlinkPath(path string) (bool, string) {
 	return false, path
 }
 
+// watcherOf returns a watcher of another file, logging to the same logger.
+func (fw *InotifyFileWatcher) watcherOf(filename string) *InotifyFileWatcher {
+	w := NewInotifyFileWatcher(filename)
+	w.Logger = fw.Logger
+	return w
+}
+
 func getInode(path string) (uint64, error) {
 	var stat syscall.Stat_t
 	if err := syscall.Stat(path, &stat); err != nil {
@@ -4,14 +4,11 @@
 package watch
 
 import (
-	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"syscall"
 
-	"github.com/hpcloud/tail/util"
-
 	"gopkg.in/fsnotify.v1"
 )
 
@@ -20,15 +17,21 @@ type InotifyTracker struct {
 	watcher   *fsnotify.Watcher
 	chans     map[string]chan fsnotify.Event
 	done      map[string]chan bool
+	dirChans  map[string]chan fsnotify.Event
+	dirDone   map[string]chan bool
 	watchNums map[string]int
 	watch     chan *watchInfo
 	remove    chan *watchInfo
 	error     chan error
+	initErr   error             // set if the fsnotify.Watcher could not be created
+	loggers   map[string]Logger // loggers of the files watched, told of errors
 }
 
 type watchInfo struct {
-	op    fsnotify.Op
-	fname string
+	op     fsnotify.Op
+	fname  string
+	dir    bool   // watch the files in directory fname
+	logger Logger // nil for DefaultLogger
 }
 
 func (this *watchInfo) isCreate() bool {
@@ -46,15 +49,22 @@ var (
 			mux:       sync.Mutex{},
 			chans:     make(map[string]chan fsnotify.Event),
 			done:      make(map[string]chan bool),
+			dirChans:  make(map[string]chan fsnotify.Event),
+			dirDone:   make(map[string]chan bool),
 			watchNums: make(map[string]int),
 			watch:     make(chan *watchInfo),
 			remove:    make(chan *watchInfo),
 			error:     make(chan error),
+			loggers:   make(map[string]Logger),
+		}
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			shared.initErr = &Error{Op: "create inotify watcher", Err: err}
+			return
 		}
+		shared.watcher = watcher
 		go shared.run()
 	}
-
-	logger = log.New(os.Stderr, "", log.LstdFlags)
 )
 
 // Watch signals the run goroutine to begin watching the input filename
@@ -73,9 +83,21 @@ func WatchCreate(fname string) error {
 	})
 }
 
+// WatchDir signals the run goroutine to begin watching the files in the
+// input directory; their events are sent to the channel returned by DirEvents.
+func WatchDir(dir string) error {
+	return watch(&watchInfo{
+		fname: dir,
+		dir:   true,
+	})
+}
+
 func watch(winfo *watchInfo) error {
 	// start running the shared InotifyTracker if not already running
 	once.Do(goRun)
+	if shared.initErr != nil {
+		return shared.initErr
+	}
 
 	winfo.fname = filepath.Clean(winfo.fname)
 	shared.watch <- winfo
@@ -97,16 +119,31 @@ func RemoveWatchCreate(fname string) {
 	})
 }
 
+// RemoveWatchDir signals the run goroutine to remove the watch for the input directory
+func RemoveWatchDir(dir string) {
+	remove(&watchInfo{
+		fname: dir,
+		dir:   true,
+	})
+}
+
 func remove(winfo *watchInfo) {
 
 	// start running the shared InotifyTracker if not already running
 	once.Do(goRun)
+	if shared.initErr != nil {
+		return
+	}
 
 	winfo.fname = filepath.Clean(winfo.fname)
 	shared.mux.Lock()
-	done := shared.done[winfo.fname]
+	doneMap := shared.done
+	if winfo.dir {
+		doneMap = shared.dirDone
+	}
+	done := doneMap[winfo.fname]
 	if done != nil {
-		delete(shared.done, winfo.fname)
+		delete(doneMap, winfo.fname)
 		close(done)
 	}
 
@@ -142,6 +179,16 @@ func Events(fname string) chan fsnotify.Event {
 	return shared.chans[fname]
 }
 
+// DirEvents returns a channel to which FileEvents for the files in the input
+// directory will be sent. This channel will be closed when RemoveWatchDir is
+// called on this directory.
+func DirEvents(dir string) chan fsnotify.Event {
+	shared.mux.Lock()
+	defer shared.mux.Unlock()
+
+	return shared.dirChans[filepath.Clean(dir)]
+}
+
 // Cleanup removes the watch for the input filename if necessary.
 func Cleanup(fname string) {
 	RemoveWatch(fname)
@@ -153,10 +200,18 @@ func (shared *InotifyTracker) addWatch(winfo *watchInfo) error {
 	shared.mux.Lock()
 	defer shared.mux.Unlock()
 
-	if shared.chans[winfo.fname] == nil {
+	if winfo.dir {
+		if shared.dirChans[winfo.fname] == nil {
+			shared.dirChans[winfo.fname] = make(chan fsnotify.Event)
+			shared.dirDone[winfo.fname] = make(chan bool)
+		}
+	} else if shared.chans[winfo.fname] == nil {
 		shared.chans[winfo.fname] = make(chan fsnotify.Event)
 		shared.done[winfo.fname] = make(chan bool)
 	}
+	if !winfo.dir && winfo.logger != nil {
+		shared.loggers[winfo.fname] = winfo.logger
+	}
 
 	fname := winfo.fname
 	if winfo.isCreate() {
@@ -189,13 +244,20 @@ func (shared *InotifyTracker) removeWatch(winfo *watchInfo) {
 	shared.mux.Lock()
 	defer shared.mux.Unlock()
 
-	ch := shared.chans[winfo.fname]
+	chans := shared.chans
+	if winfo.dir {
+		chans = shared.dirChans
+	}
+	ch := chans[winfo.fname]
 	if ch == nil {
 		return
 	}
 
-	delete(shared.chans, winfo.fname)
+	delete(chans, winfo.fname)
 	close(ch)
+	if !winfo.dir {
+		delete(shared.loggers, winfo.fname)
+	}
 
 	if !winfo.isCreate() {
 		return
@@ -211,9 +273,13 @@ func (shared *InotifyTracker) removeWatch(winfo *watchInfo) {
 func (shared *InotifyTracker) sendEvent(event fsnotify.Event) {
 	name := filepath.Clean(event.Name)
 
+	dir := filepath.Dir(name)
+
 	shared.mux.Lock()
 	ch := shared.chans[name]
 	done := shared.done[name]
+	dirCh := shared.dirChans[dir]
+	dirDone := shared.dirDone[dir]
 	shared.mux.Unlock()
 
 	if ch != nil && done != nil {
@@ -222,17 +288,17 @@ func (shared *InotifyTracker) sendEvent(event fsnotify.Event) {
 		case <-done:
 		}
 	}
+	if dirCh != nil && dirDone != nil {
+		select {
+		case dirCh <- event:
+		case <-dirDone:
+		}
+	}
 }
 
 // run starts the goroutine in which the shared struct reads events from its
 // Watcher's Event channel and sends the events to the appropriate Tail.
 func (shared *InotifyTracker) run() {
-	watcher, err := fsnotify.NewWatcher()
-	if err != nil {
-		util.Fatal("failed to create Watcher")
-	}
-	shared.watcher = watcher
-
 	for {
 		select {
 		case winfo := <-shared.watch:
@@ -253,9 +319,27 @@ func (shared *InotifyTracker) run() {
 			} else if err != nil {
 				sysErr, ok := err.(*os.SyscallError)
 				if !ok || sysErr.Err != syscall.EINTR {
-					logger.Printf("Error in Watcher Error channel: %s", err)
+					shared.logError("Error in inotify watcher", "err", err)
 				}
 			}
 		}
 	}
 }
+
+// logError logs an error of the watcher, not tied to a file, to the
+// loggers of the files watched.
+func (shared *InotifyTracker) logError(msg string, keyvals ...interface{}) {
+	shared.mux.Lock()
+	loggers := make([]Logger, 0, len(shared.loggers))
+	for _, l := range shared.loggers {
+		loggers = append(loggers, l)
+	}
+	shared.mux.Unlock()
+
+	if len(loggers) == 0 {
+		loggers = append(loggers, DefaultLogger)
+	}
+	for _, l := range loggers {
+		l.Error(msg, keyvals...)
+	}
+}
@@ -0,0 +1,79 @@
+package watch
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Logger is a leveled logger taking alternating keys and values after the
+// message, like log/slog, whose *slog.Logger is a Logger.
+type Logger interface {
+	Debug(msg string, keyvals ...interface{})
+	Info(msg string, keyvals ...interface{})
+	Warn(msg string, keyvals ...interface{})
+	Error(msg string, keyvals ...interface{})
+}
+
+// DefaultLogger is used by the watchers without a Logger, and by
+// InotifyTracker for the errors of the files watched without one.
+var DefaultLogger Logger = NewStdLogger(log.New(os.Stderr, "", log.LstdFlags))
+
+// NewStdLogger returns a Logger printing to l, such as a *log.Logger, as
+// "LEVEL message key=value ...". Debug messages are dropped.
+func NewStdLogger(l interface {
+	Printf(format string, v ...interface{})
+}) Logger {
+	return stdLogger{l}
+}
+
+type stdLogger struct {
+	l interface {
+		Printf(format string, v ...interface{})
+	}
+}
+
+func (s stdLogger) Debug(msg string, keyvals ...interface{}) {}
+
+func (s stdLogger) Info(msg string, keyvals ...interface{}) {
+	s.print("INFO", msg, keyvals)
+}
+
+func (s stdLogger) Warn(msg string, keyvals ...interface{}) {
+	s.print("WARN", msg, keyvals)
+}
+
+func (s stdLogger) Error(msg string, keyvals ...interface{}) {
+	s.print("ERROR", msg, keyvals)
+}
+
+func (s stdLogger) print(level, msg string, keyvals []interface{}) {
+	var b bytes.Buffer
+	b.WriteString(level)
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		fmt.Fprintf(&b, " %v=", keyvals[i])
+		if i+1 == len(keyvals) {
+			b.WriteString("!MISSING")
+			break
+		}
+		v := fmt.Sprint(keyvals[i+1])
+		if v == "" || strings.ContainsAny(v, " \t\n\"=") {
+			v = strconv.Quote(v)
+		}
+		b.WriteString(v)
+	}
+	s.l.Printf("%s", b.String())
+}
+
+// loggerOr returns l, or DefaultLogger if l is nil.
+func loggerOr(l Logger) Logger {
+	if l == nil {
+		return DefaultLogger
+	}
+	return l
+}
@@ -4,11 +4,11 @@
 package watch
 
 import (
+	"context"
 	"os"
 	"runtime"
 	"time"
 
-	"github.com/hpcloud/tail/util"
 	"gopkg.in/tomb.v1"
 )
 
@@ -16,16 +16,40 @@ import (
 type PollingFileWatcher struct {
 	Filename string
 	Size     int64
+
+	// FingerprintSize is the number of bytes at the start of the file
+	// compared on changes, to detect the file being truncated and written
+	// again past its previous size. Disabled if zero.
+	FingerprintSize int
+
+	// Opened, if set, describes the file open at Filename. ChangeEvents
+	// reports it moved or deleted right away if Filename is another file,
+	// or none, by the time changes are watched.
+	Opened os.FileInfo
+
+	Logger Logger // (default: DefaultLogger)
 }
 
 func NewPollingFileWatcher(filename string) *PollingFileWatcher {
-	fw := &PollingFileWatcher{filename, 0}
+	fw := &PollingFileWatcher{Filename: filename}
 	return fw
 }
 
+func (fw *PollingFileWatcher) logger() Logger {
+	return loggerOr(fw.Logger)
+}
+
 var POLL_DURATION time.Duration
 
 func (fw *PollingFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
+	return tombErr(fw.blockUntilExists(t.Dying()))
+}
+
+func (fw *PollingFileWatcher) BlockUntilExistsContext(ctx context.Context) error {
+	return contextErr(ctx, fw.blockUntilExists(ctx.Done()))
+}
+
+func (fw *PollingFileWatcher) blockUntilExists(done <-chan struct{}) error {
 	for {
 		if _, err := os.Stat(fw.Filename); err == nil {
 			return nil
@@ -35,15 +59,28 @@ func (fw *PollingFileWatcher) BlockUntilExists(t *tomb.Tomb) error {
 		select {
 		case <-time.After(POLL_DURATION):
 			continue
-		case <-t.Dying():
-			return tomb.ErrDying
+		case <-done:
+			return errDone
 		}
 	}
 	panic("unreachable")
 }
 
 func (fw *PollingFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChanges, error) {
+	return fw.changeEvents(t.Dying(), pos)
+}
+
+func (fw *PollingFileWatcher) ChangeEventsContext(ctx context.Context, pos int64) (*FileChanges, error) {
+	return fw.changeEvents(ctx.Done(), pos)
+}
+
+func (fw *PollingFileWatcher) changeEvents(done <-chan struct{}, pos int64) (*FileChanges, error) {
 	origFi, err := os.Stat(fw.Filename)
+	if replaced(fw.Opened, origFi, err) {
+		changes := NewFileChanges()
+		go changes.notifyReplaced(done, false)
+		return changes, nil
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -51,16 +88,15 @@ func (fw *PollingFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChange
 	changes := NewFileChanges()
 	var prevModTime time.Time
 
-	// XXX: use tomb.Tomb to cleanly manage these goroutines. replace
-	// the fatal (below) with tomb's Kill.
-
 	fw.Size = pos
+	fp := newFingerprint(fw.Filename, fw.FingerprintSize)
 
 	go func() {
 		prevSize := fw.Size
+		recheck := false // a check of the fingerprint put off
 		for {
 			select {
-			case <-t.Dying():
+			case <-done:
 				return
 			default:
 			}
@@ -72,16 +108,18 @@ func (fw *PollingFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChange
 				// so it gives access denied to anything trying to read it until all handles are released.
 				if os.IsNotExist(err) || (runtime.GOOS == "windows" && os.IsPermission(err)) {
 					// File does not exist (has been deleted).
+					fw.logger().Debug("File deleted", "file", fw.Filename)
 					changes.NotifyDeleted()
 					return
 				}
 
-				// XXX: report this error back to the user
-				util.Fatal("Failed to stat file %v: %v", fw.Filename, err)
+				changes.NotifyError(&Error{Op: "stat", Filename: fw.Filename, Err: err})
+				return
 			}
 
 			// File got moved/renamed?
 			if !os.SameFile(origFi, fi) {
+				fw.logger().Debug("File moved or renamed", "file", fw.Filename)
 				changes.NotifyDeleted()
 				return
 			}
@@ -89,24 +127,30 @@ func (fw *PollingFileWatcher) ChangeEvents(t *tomb.Tomb, pos int64) (*FileChange
 			// File got truncated?
 			fw.Size = fi.Size()
 			if prevSize > 0 && prevSize > fw.Size {
-				changes.NotifyTruncated()
-				prevSize = fw.Size
-				continue
-			}
-			// File got bigger?
-			if prevSize > 0 && prevSize < fw.Size {
-				changes.NotifyModified()
+				changes.NotifyTruncatedFrom(prevSize)
+				fp.reset(fw.Filename)
 				prevSize = fw.Size
 				continue
 			}
-			prevSize = fw.Size
 
-			// File was appended to (changed)?
+			// File got bigger or was appended to (changed)?
 			modTime := fi.ModTime()
-			if modTime != prevModTime {
-				prevModTime = modTime
+			modified := prevSize > 0 && prevSize < fw.Size || modTime != prevModTime
+			// ... or truncated and written again past its size? The first
+			// poll compares with the fingerprint just taken.
+			if modified && !prevModTime.IsZero() || recheck {
+				recheck = fp.wait() > 0
+				if !recheck && fp.changed(fw.Filename) {
+					changes.NotifyTruncatedFrom(prevSize)
+					fp.reset(fw.Filename)
+					modified = false
+				}
+			}
+			if modified {
 				changes.NotifyModified()
 			}
+			prevSize = fw.Size
+			prevModTime = modTime
 		}
 	}()
 
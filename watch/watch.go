@@ -3,13 +3,22 @@
 
 package watch
 
-import "gopkg.in/tomb.v1"
+import (
+	"context"
+	"errors"
+
+	"gopkg.in/tomb.v1"
+)
 
 // FileWatcher monitors file-level events.
 type FileWatcher interface {
 	// BlockUntilExists blocks until the file comes into existence.
 	BlockUntilExists(*tomb.Tomb) error
 
+	// BlockUntilExistsContext is like BlockUntilExists, but gives up
+	// with ctx.Err() when the context is done.
+	BlockUntilExistsContext(context.Context) error
+
 	// ChangeEvents reports on changes to a file, be it modification,
 	// deletion, renames or truncations. Returned FileChanges group of
 	// channels will be closed, thus become unusable, after a deletion
@@ -17,4 +26,44 @@ type FileWatcher interface {
 	// In order to properly report truncations, ChangeEvents requires
 	// the caller to pass their current offset in the file.
 	ChangeEvents(*tomb.Tomb, int64) (*FileChanges, error)
+
+	// ChangeEventsContext is like ChangeEvents, but stops watching when
+	// the context is done.
+	ChangeEventsContext(context.Context, int64) (*FileChanges, error)
+}
+
+// Error records a failure to watch a file.
+type Error struct {
+	Op       string // Operation that failed
+	Filename string // File being watched, if any
+	Err      error  // Underlying error
+}
+
+func (e *Error) Error() string {
+	if e.Filename == "" {
+		return "watch: " + e.Op + ": " + e.Err.Error()
+	}
+	return "watch: " + e.Op + " " + e.Filename + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// errDone is returned by the watchers when their done channel is closed,
+// and translated to tomb.ErrDying or ctx.Err() by the exported methods.
+var errDone = errors.New("watch: done")
+
+func tombErr(err error) error {
+	if err == errDone {
+		return tomb.ErrDying
+	}
+	return err
+}
+
+func contextErr(ctx context.Context, err error) error {
+	if err == errDone {
+		return ctx.Err()
+	}
+	return err
 }
@@ -1,7 +1,12 @@
 package watch
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	tomb "gopkg.in/tomb.v1"
 )
@@ -13,3 +18,169 @@ func TestBlockUntilExists(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestBlockUntilExistsContext(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file")
+
+	for _, fw := range []FileWatcher{NewInotifyFileWatcher(filename), NewPollingFileWatcher(filename)} {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		err := fw.BlockUntilExistsContext(ctx)
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Errorf("%T: expected context.DeadlineExceeded, got %v", fw, err)
+		}
+	}
+}
+
+func TestPollingReportsStatError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sub := filepath.Join(dir, "sub")
+	filename := filepath.Join(sub, "file")
+	os.Mkdir(sub, 0700)
+	if err := ioutil.WriteFile(filename, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := NewPollingFileWatcher(filename).ChangeEventsContext(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// replacing the directory by a file makes stat fail with ENOTDIR
+	os.RemoveAll(sub)
+	if err := ioutil.WriteFile(sub, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-changes.Error:
+		if werr, ok := err.(*Error); !ok || werr.Op != "stat" || werr.Filename != filename {
+			t.Errorf("expected stat *Error, got %#v", err)
+		}
+	case <-changes.Deleted:
+		t.Error("expected an error, got a deletion")
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for the error")
+	}
+}
+
+func TestChangeEventsOfReplacedFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file")
+
+	inotify, polling := NewInotifyFileWatcher(filename), NewPollingFileWatcher(filename)
+	for _, c := range []struct {
+		fw     FileWatcher
+		opened *os.FileInfo
+	}{
+		{inotify, &inotify.Opened},
+		{polling, &polling.Opened},
+	} {
+		if err := ioutil.WriteFile(filename, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *c.opened, err = f.Stat(); err != nil {
+			t.Fatal(err)
+		}
+
+		// moved, then replaced, before being watched
+		os.Rename(filename, filename+".1")
+		changes, err := c.fw.ChangeEventsContext(context.Background(), 0)
+		if err != nil {
+			t.Errorf("%T: %v", c.fw, err)
+		} else {
+			select {
+			case <-changes.Deleted:
+			case <-time.After(time.Second):
+				t.Errorf("%T: expected the file moved to be reported", c.fw)
+			}
+		}
+
+		if err := ioutil.WriteFile(filename, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		changes, err = c.fw.ChangeEventsContext(ctx, 0)
+		if err != nil {
+			t.Errorf("%T: %v", c.fw, err)
+		} else {
+			select {
+			case <-changes.Deleted:
+			case <-time.After(time.Second):
+				t.Errorf("%T: expected the file replaced to be reported", c.fw)
+			}
+		}
+		cancel()
+		f.Close()
+		os.Remove(filename)
+		os.Remove(filename + ".1")
+	}
+}
+
+func TestFingerprintCheckPutOff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "file")
+
+	inotify, polling := NewInotifyFileWatcher(filename), NewPollingFileWatcher(filename)
+	inotify.FingerprintSize, polling.FingerprintSize = 16, 16
+	for _, fw := range []FileWatcher{inotify, polling} {
+		if err := ioutil.WriteFile(filename, []byte("hello\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		changes, err := fw.ChangeEventsContext(ctx, 6)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// an append is checked, and a rewrite right after it only once
+		// FingerprintInterval has passed
+		f, _ := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0)
+		f.WriteString("world\n")
+		f.Close()
+		select {
+		case <-changes.Modified:
+		case <-changes.Truncated:
+			t.Errorf("%T: append reported as a truncation", fw)
+		case <-time.After(time.Second):
+			t.Errorf("%T: append not reported", fw)
+		}
+		// written over in place, so that only the fingerprint tells
+		f, _ = os.OpenFile(filename, os.O_WRONLY, 0)
+		f.WriteString("rewritten past its size\n")
+		f.Close()
+		timeout := time.After(time.Second)
+	wait:
+		for {
+			select {
+			case <-changes.Modified:
+			case <-changes.Truncated:
+				break wait
+			case <-timeout:
+				t.Errorf("%T: rewrite not reported", fw)
+				break wait
+			}
+		}
+		cancel()
+	}
+}